@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/infra/logger"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// recordAudit stores who performed action on an entity, with JSON snapshots before and after.
+// Pass nil for a side that does not exist (before on create, after on delete).
+// Failures are logged rather than failing the request that made the change.
+func recordAudit(tx *gorm.DB, c *gin.Context, action, entityType string, entityID uint, before, after interface{}) {
+	var actor *uint
+	if user, ok := c.Get("current_user"); ok {
+		id := user.(models.User).ID
+		actor = &id
+	}
+	writeAudit(tx, c, actor, action, entityType, entityID, before, after)
+}
+
+// recordAuditBy is recordAudit for requests that act for user actorID before anyone signed in,
+// such as registering or redeeming a mailed token
+func recordAuditBy(tx *gorm.DB, c *gin.Context, actorID uint, action, entityType string, entityID uint, before, after interface{}) {
+	writeAudit(tx, c, &actorID, action, entityType, entityID, before, after)
+}
+
+func writeAudit(tx *gorm.DB, c *gin.Context, actor *uint, action, entityType string, entityID uint, before, after interface{}) {
+	entry := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Before:     auditSnapshot(before),
+		After:      auditSnapshot(after),
+		IP:         c.ClientIP(),
+		UserAgent:  truncate(c.Request.UserAgent(), 255),
+	}
+	if changes, err := json.Marshal(helpers.JSONDiff(entry.Before, entry.After)); err == nil {
+		entry.Changes = changes
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		logger.Errorf("audit %s %s %d failed: %v", action, entityType, entityID, err)
+	}
+}
+
+func auditSnapshot(v interface{}) datatypes.JSON {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+var auditLogListOptions = helpers.ListOptions{
+	Sortable: map[string]string{"created_at": "created_at"},
+	Filters: map[string]helpers.Filter{
+		"user_id":     helpers.Equals("user_id"),
+		"action":      helpers.Equals("action"),
+		"entity_type": helpers.Equals("entity_type"),
+		"entity_id":   helpers.Equals("entity_id"),
+		"from":        createdAtBound(">="),
+		"to":          createdAtBound("<="),
+	},
+	DefaultSort: "-id",
+}
+
+// createdAtBound filters on created_at against an RFC 3339 time
+func createdAtBound(op string) helpers.Filter {
+	return func(db *gorm.DB, value string) (*gorm.DB, error) {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, helpers.QueryErrorf("invalid time %q, expected RFC 3339", value)
+		}
+		return db.Where("created_at "+op+" ?", t), nil
+	}
+}
+
+// GetAuditLogs lists audit entries, newest first, filtered by user_id, action, entity_type,
+// entity_id and a from/to time range (RFC 3339)
+func GetAuditLogs(c *gin.Context) {
+	var logs []models.AuditLog
+	meta, err := helpers.Paginate(c, database.DB, auditLogListOptions, &logs)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch audit logs", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Audit logs retrieved", Data: logs, Meta: meta})
+}
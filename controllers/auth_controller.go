@@ -1,15 +1,21 @@
 package controllers
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"beres/helpers"
 	"beres/infra/database"
+	"beres/infra/logger"
+	"beres/infra/throttle"
 	"beres/models"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func Register(c *gin.Context) {
@@ -23,11 +29,16 @@ func Register(c *gin.Context) {
 		return
 	}
 	hash, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-	user := models.User{Name: input.Name, Email: input.Email, PasswordHash: string(hash)}
+	// admins are seeded with ADMIN_EMAIL, never through this public endpoint
+	user := models.User{Name: input.Name, Email: input.Email, PasswordHash: string(hash), Role: models.RoleSubscriber}
 	if err := database.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Registration failed", Data: err.Error()})
+		userWriteError(c, err, "Registration failed")
 		return
 	}
+	recordAuditBy(database.DB, c, user.ID, models.AuditCreate, "user", user.ID, nil, user)
+	if err := sendVerificationEmail(user); err != nil {
+		logger.Errorf("verification mail for user %d failed: %v", user.ID, err)
+	}
 	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "User registered", Data: user})
 }
 
@@ -41,38 +52,98 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
 		return
 	}
+	if loginThrottled(c, input.Email) {
+		return
+	}
 	var user models.User
-	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid credentials"})
+	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil || !checkPassword(user, input.Password) {
+		if !recordLoginFailure(c, input.Email) {
+			c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid credentials"})
+		}
 		return
 	}
-	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)) != nil {
-		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid credentials"})
+	if !user.Active() {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "Account deactivated"})
 		return
 	}
+	if user.TwoFactorEnabled() {
+		challenge, err := issueVerificationToken(user.ID, models.TokenPurposeTwoFactor, twoFactorChallengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Login failed", Data: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Two-factor authentication required", Data: gin.H{"two_factor": true, "challenge": challenge}})
+		return
+	}
+	completeLogin(c, user, input.TokenName)
+}
+
+// loginThrottled writes a 429 and reports true while the email or the client IP is locked out
+func loginThrottled(c *gin.Context, email string) bool {
+	wait := max(throttle.LoginEmail.RetryAfter(loginEmailKey(email)), throttle.LoginIP.RetryAfter(c.ClientIP()))
+	if wait <= 0 {
+		return false
+	}
+	tooManyAttempts(c, wait)
+	return true
+}
+
+// recordLoginFailure counts a failed attempt; if that triggers a lockout it writes a 429 and reports true
+func recordLoginFailure(c *gin.Context, email string) bool {
+	throttle.LoginIPsByEmail.Add(loginEmailKey(email), c.ClientIP())
+	wait := max(throttle.LoginEmail.Fail(loginEmailKey(email)), throttle.LoginIP.Fail(c.ClientIP()))
+	if wait <= 0 {
+		return false
+	}
+	tooManyAttempts(c, wait)
+	return true
+}
+
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	tooManyRequests(c, wait, "Too many login attempts")
+}
+
+// tooManyRequests answers 429, telling the client to retry after wait
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, helpers.Response{Code: http.StatusTooManyRequests, Message: message, Data: gin.H{"retry_after": seconds}})
+}
+
+func loginEmailKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// issueToken fills in a fresh secret for token, stores it and returns the raw value, which is never persisted
+func issueToken(tx *gorm.DB, token *models.PersonalAccessToken) (string, error) {
 	// Generate a random token (e.g. 40-char string)
 	rawToken := helpers.GenerateRandomString(40)
-	hash := helpers.HashToken(rawToken)
 	now := time.Now()
-	token := models.PersonalAccessToken{
-		UserID:     user.ID,
-		Name:       input.TokenName,
-		TokenHash:  hash,
-		Abilities:  "*",
-		LastUsedAt: &now,
-		ExpiresAt:  ptrTime(time.Now().Add(24 * time.Hour)),
+	token.TokenHash = helpers.HashToken(rawToken)
+	token.LastUsedAt = &now
+	if err := tx.Create(token).Error; err != nil {
+		return "", err
 	}
-	if err := database.DB.Create(&token).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Token creation failed", Data: err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Login successful", Data: gin.H{"token": rawToken}})
+	return rawToken, nil
 }
 
 func Logout(c *gin.Context) {
 	t := c.GetString("token_hash") // set by middleware
 	database.DB.Where("token_hash = ?", t).Delete(&models.PersonalAccessToken{})
+	if token := c.MustGet("current_token").(models.PersonalAccessToken); token.FamilyID != "" {
+		revokeTokenFamily(database.DB, token.FamilyID)
+	}
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Logged out"})
 }
 
+// checkPassword reports whether password matches the user's stored hash
+func checkPassword(user models.User, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
 func ptrTime(t time.Time) *time.Time { return &t }
+
+// currentUser returns the user set by middleware.TokenAuth
+func currentUser(c *gin.Context) models.User {
+	return c.MustGet("current_user").(models.User)
+}
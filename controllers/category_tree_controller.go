@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errUnknownParent = errors.New("parent category does not exist")
+	errCategoryCycle = errors.New("a category cannot be placed under itself or one of its descendants")
+)
+
+type moveCategoryInput struct {
+	ParentID *uint `json:"parent_id"` // null moves the category to the top level
+}
+
+// categoryNode is a category of the tree returned by GetCategoryTree
+type categoryNode struct {
+	models.Category
+	PostCount      int             `json:"post_count"`       // visible posts filed under the category itself
+	TotalPostCount int             `json:"total_post_count"` // visible posts filed under it or a descendant, each counted once
+	Children       []*categoryNode `json:"Children"`
+	parent         *categoryNode
+}
+
+// GetCategoryTree returns every category nested under its parent, each level ordered by name,
+// with the number of posts the caller may see in it
+func GetCategoryTree(c *gin.Context) {
+	var categories []models.Category
+	if err := database.DB.Order("name").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch categories", Data: err.Error()})
+		return
+	}
+	nodes := make(map[uint]*categoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &categoryNode{Category: category, Children: []*categoryNode{}}
+	}
+	roots := []*categoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				node.parent = parent
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		// children of a category in the trash show at the top level until it is restored or purged
+		roots = append(roots, node)
+	}
+	if err := countCategoryPosts(c, nodes); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to count posts", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Category tree retrieved", Data: roots})
+}
+
+// countCategoryPosts fills in the post counts of nodes. A post filed under several categories of
+// one branch counts once towards each of their ancestors.
+func countCategoryPosts(c *gin.Context, nodes map[uint]*categoryNode) error {
+	rows, err := database.DB.Model(&models.Post{}).
+		Scopes(visiblePosts(c)).
+		Joins("JOIN posts_categories ON posts_categories.post_id = posts.id").
+		Select("posts.id, posts_categories.category_id").
+		Order("posts.id").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current uint
+	counted := map[uint]bool{} // categories already counting the current post
+	for rows.Next() {
+		var postID, categoryID uint
+		if err := rows.Scan(&postID, &categoryID); err != nil {
+			return err
+		}
+		if postID != current {
+			current, counted = postID, map[uint]bool{}
+		}
+		node, ok := nodes[categoryID]
+		if !ok {
+			continue
+		}
+		node.PostCount++
+		for ; node != nil && !counted[node.ID]; node = node.parent {
+			counted[node.ID] = true
+			node.TotalPostCount++
+		}
+	}
+	return rows.Err()
+}
+
+// GetCategoryBreadcrumbs lists the category named by :id, a slug or an ID, and its ancestors
+// from the top level down
+func GetCategoryBreadcrumbs(c *gin.Context) {
+	var category models.Category
+	if err := firstBySlugOrID(database.DB, &category, c.Param("id")); err != nil {
+		if categorySlugs.redirect(c, database.DB, "id") {
+			return
+		}
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Category not found"})
+		return
+	}
+	trail := []models.Category{category}
+	seen := map[uint]bool{category.ID: true}
+	for parentID := category.ParentID; parentID != nil && !seen[*parentID]; {
+		var parent models.Category
+		if err := database.DB.First(&parent, *parentID).Error; err != nil {
+			break // the trail ends at a category in the trash
+		}
+		seen[parent.ID] = true
+		trail = append(trail, parent)
+		parentID = parent.ParentID
+	}
+	for i, j := 0, len(trail)-1; i < j; i, j = i+1, j-1 {
+		trail[i], trail[j] = trail[j], trail[i]
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Breadcrumbs retrieved", Data: trail})
+}
+
+// MoveCategory re-parents a category together with its subtree
+func MoveCategory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid category ID"})
+		return
+	}
+	var category models.Category
+	if err := database.DB.First(&category, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Category not found"})
+		return
+	}
+	if !ifMatch(c, category.ID, category.Version) {
+		return
+	}
+	var input moveCategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := category
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkCategoryParent(tx, category.ID, input.ParentID); err != nil {
+			return err
+		}
+		err := versioned(tx.Model(&category).Where("version = ?", before.Version).
+			Select("ParentID", "Version").
+			Updates(models.Category{Versioned: models.Versioned{Version: before.Version + 1}, ParentID: input.ParentID}))
+		if err != nil {
+			return err
+		}
+		return touchCategories(tx, before.ParentID, input.ParentID)
+	})
+	if err != nil {
+		categoryWriteError(c, err, category.ID, "Failed to move category")
+		return
+	}
+	recordAudit(database.DB, c, "move", "category", category.ID, before, category)
+	c.Header("ETag", helpers.ETag(category.ID, category.Version))
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Category moved", Data: category})
+}
+
+// checkCategoryParent checks that category id (0 for a new one) may be placed under parentID:
+// the parent exists and is neither the category nor one of its descendants. The ancestors are
+// locked until tx ends, so two concurrent moves cannot close a cycle between them.
+func checkCategoryParent(tx *gorm.DB, id uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	var parent models.Category
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&parent, *parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errUnknownParent
+		}
+		return err
+	}
+	seen := map[uint]bool{}
+	for ancestor := parent; ; {
+		if ancestor.ID == id {
+			return errCategoryCycle
+		}
+		if ancestor.ParentID == nil || seen[ancestor.ID] {
+			return nil
+		}
+		seen[ancestor.ID] = true
+		next := *ancestor.ParentID
+		ancestor = models.Category{}
+		// ancestors in the trash count too, as restoring them brings the link back
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&ancestor, next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// touchCategories moves the version of the parents that are set, after a child of theirs changed:
+// their representations list their children
+func touchCategories(tx *gorm.DB, parents ...*uint) error {
+	var ids []uint
+	for _, id := range parents {
+		if id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Model(&models.Category{}).Where("id IN ?", ids).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// categoryWriteError responds to an error from writing a category
+func categoryWriteError(c *gin.Context, err error, id uint, message string) {
+	switch {
+	case errors.Is(err, errUnknownParent):
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Parent category does not exist"})
+	case errors.Is(err, errCategoryCycle):
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "A category cannot be placed under itself or one of its descendants"})
+	case isSlugError(err):
+		slugError(c, err)
+	default:
+		writeError(c, err, &models.Category{}, id, message)
+	}
+}
+
+// sameID reports whether two optional IDs are equal
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"beres/helpers"
+	"beres/infra/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// errStaleVersion is returned by a write that did not find the row at the version it read
+var errStaleVersion = errors.New("resource was modified")
+
+// notModified sets the ETag of version of row id and answers 304 if the request's If-None-Match
+// already names it. It reports whether it did.
+func notModified(c *gin.Context, id, version uint) bool {
+	return notModifiedTag(c, helpers.ETag(id, version))
+}
+
+// notModifiedTag is notModified for a representation tagged etag
+func notModifiedTag(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && helpers.ETagMatches(match, etag, true) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// ifMatch checks the request's If-Match against version of row id. It answers 412 when the
+// request names another version, and 428 when it names none and REQUIRE_IF_MATCH is set.
+// It reports whether the write may go ahead.
+func ifMatch(c *gin.Context, id, version uint) bool {
+	match := c.GetHeader("If-Match")
+	if match == "" {
+		if !viper.GetBool("REQUIRE_IF_MATCH") {
+			return true
+		}
+		c.Header("ETag", helpers.ETag(id, version))
+		c.JSON(http.StatusPreconditionRequired, helpers.Response{Code: http.StatusPreconditionRequired, Message: "If-Match header required", Data: versionData(id, version)})
+		return false
+	}
+	if helpers.ETagMatches(match, helpers.ETag(id, version), false) {
+		return true
+	}
+	staleVersion(c, id, version)
+	return false
+}
+
+// staleVersion answers 412 with the current version of row id
+func staleVersion(c *gin.Context, id, version uint) {
+	c.Header("ETag", helpers.ETag(id, version))
+	c.JSON(http.StatusPreconditionFailed, helpers.Response{Code: http.StatusPreconditionFailed, Message: "Resource was modified", Data: versionData(id, version)})
+}
+
+// staleRow answers 412 with the version row id of model has now, after a write returned errStaleVersion
+func staleRow(c *gin.Context, model interface{}, id uint) {
+	var versions []uint
+	database.DB.Model(model).Where("id = ?", id).Limit(1).Pluck("version", &versions)
+	if len(versions) == 0 {
+		c.JSON(http.StatusPreconditionFailed, helpers.Response{Code: http.StatusPreconditionFailed, Message: "Resource was deleted"})
+		return
+	}
+	staleVersion(c, id, versions[0])
+}
+
+func versionData(id, version uint) gin.H {
+	return gin.H{"version": version, "etag": helpers.ETag(id, version)}
+}
+
+// versioned returns the error of a write limited to the version it read, or errStaleVersion if it changed nothing
+func versioned(res *gorm.DB) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errStaleVersion
+	}
+	return nil
+}
+
+// writeError responds to the failure of a versioned write of row id of model
+func writeError(c *gin.Context, err error, model interface{}, id uint, message string) {
+	if errors.Is(err, errStaleVersion) {
+		staleRow(c, model, id)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: message, Data: err.Error()})
+}
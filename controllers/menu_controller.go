@@ -9,6 +9,7 @@ import (
 	"beres/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // DTOs
@@ -29,20 +30,29 @@ type menuItemInput struct {
 
 // ----- Menu Handlers -----
 
-// GetMenus lists all menus with nested items
+var menuListOptions = helpers.ListOptions{
+	Sortable:    map[string]string{"name": "name", "location": "location", "created_at": "created_at"},
+	Filters:     map[string]helpers.Filter{"location": helpers.Equals("location")},
+	DefaultSort: "id",
+}
+
+// GetMenus lists menus with their item trees, one page at a time
 func GetMenus(c *gin.Context) {
 	var menus []models.Menu
-	db := database.DB.
-		Preload("Items").
-		Preload("Items.Children")
-	if err := db.Find(&menus).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch menus", Data: err.Error()})
+	meta, err := helpers.Paginate(c, database.DB, menuListOptions, &menus)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch menus", Data: err.Error()})
+		return
+	}
+	if err := loadMenuTrees(database.DB, menus); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch menu items", Data: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menus retrieved", Data: menus})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menus retrieved", Data: menus, Meta: meta})
 }
 
-// GetMenuByID returns a single menu by ID
+// GetMenuByID returns a single menu by ID with its item tree
 func GetMenuByID(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
@@ -50,13 +60,19 @@ func GetMenuByID(c *gin.Context) {
 		return
 	}
 	var menu models.Menu
-	db := database.DB.
-		Preload("Items").
-		Preload("Items.Children")
-	if err := db.First(&menu, id).Error; err != nil {
+	if err := database.DB.First(&menu, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Menu not found"})
 		return
 	}
+	if notModified(c, menu.ID, menu.Version) {
+		return
+	}
+	menus := []models.Menu{menu}
+	if err := loadMenuTrees(database.DB, menus); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch menu items", Data: err.Error()})
+		return
+	}
+	menu = menus[0]
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu retrieved", Data: menu})
 }
 
@@ -72,27 +88,40 @@ func CreateMenu(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to create menu", Data: err.Error()})
 		return
 	}
+	recordAudit(database.DB, c, models.AuditCreate, "menu", menu.ID, nil, menu)
 	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "Menu created", Data: menu})
 }
 
-// UpdateMenu updates an existing menu
+// UpdateMenu updates an existing menu from a full body (PUT) or a merge patch (PATCH)
 func UpdateMenu(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid menu ID"})
 		return
 	}
-	var input menuInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
-		return
-	}
 	var menu models.Menu
 	if err := database.DB.First(&menu, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Menu not found"})
 		return
 	}
-	database.DB.Model(&menu).Updates(models.Menu{Name: input.Name, Location: input.Location})
+	if !ifMatch(c, menu.ID, menu.Version) {
+		return
+	}
+	input := menuInput{Name: menu.Name, Location: menu.Location}
+	if err := helpers.BindUpdate(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := menu
+	err = versioned(database.DB.Model(&menu).Where("version = ?", before.Version).
+		Select("Name", "Location", "Version").
+		Updates(models.Menu{Versioned: models.Versioned{Version: before.Version + 1}, Name: input.Name, Location: input.Location}))
+	if err != nil {
+		writeError(c, err, &models.Menu{}, menu.ID, "Failed to update menu")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditUpdate, "menu", menu.ID, before, menu)
+	c.Header("ETag", helpers.ETag(menu.ID, menu.Version))
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu updated", Data: menu})
 }
 
@@ -103,33 +132,45 @@ func DeleteMenu(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid menu ID"})
 		return
 	}
-	if err := database.DB.Delete(&models.Menu{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to delete menu", Data: err.Error()})
+	var menu models.Menu
+	if err := database.DB.First(&menu, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Menu not found"})
 		return
 	}
+	if !ifMatch(c, menu.ID, menu.Version) {
+		return
+	}
+	if err := versioned(database.DB.Where("version = ?", menu.Version).Delete(&menu)); err != nil {
+		writeError(c, err, &models.Menu{}, menu.ID, "Failed to delete menu")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditDelete, "menu", menu.ID, menu, nil)
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu deleted"})
 }
 
 // ----- MenuItem Handlers -----
 
-// GetMenuItems lists items for a specific menu, including nested children
+// GetMenuItems returns the items of menu :id as a tree
 func GetMenuItems(c *gin.Context) {
-	menuID, err := strconv.ParseUint(c.Param("menu_id"), 10, 64)
+	menuID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid menu ID"})
 		return
 	}
+	var menu models.Menu
+	if err := database.DB.First(&menu, menuID).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Menu not found"})
+		return
+	}
 	var items []models.MenuItem
-	db := database.DB.Where("menu_id = ?", menuID).
-		Preload("Children")
-	if err := db.Find(&items).Error; err != nil {
+	if err := database.DB.Where("menu_id = ?", menu.ID).Find(&items).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch menu items", Data: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu items retrieved", Data: items})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu items retrieved", Data: menuTree(items, nil)})
 }
 
-// GetMenuItemByID returns one menu item by ID
+// GetMenuItemByID returns one menu item by ID with the tree of items below it
 func GetMenuItemByID(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
@@ -137,10 +178,19 @@ func GetMenuItemByID(c *gin.Context) {
 		return
 	}
 	var item models.MenuItem
-	if err := database.DB.Preload("Children").First(&item, id).Error; err != nil {
+	if err := database.DB.First(&item, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Menu item not found"})
 		return
 	}
+	if notModified(c, item.ID, item.Version) {
+		return
+	}
+	var items []models.MenuItem
+	if err := database.DB.Where("menu_id = ?", item.MenuID).Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch menu items", Data: err.Error()})
+		return
+	}
+	item.Children = menuTree(items, &item.ID)
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu item retrieved", Data: item})
 }
 
@@ -160,39 +210,98 @@ func CreateMenuItem(c *gin.Context) {
 		Class:    input.Class,
 		Target:   input.Target,
 	}
-	if err := database.DB.Create(&item).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to create menu item", Data: err.Error()})
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkMenuItemParent(tx, 0, item.MenuID, item.ParentID); err != nil {
+			return err
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return touchMenuItems(tx, item.MenuID, item.ParentID)
+	})
+	if err != nil {
+		menuItemWriteError(c, err, 0, "Failed to create menu item")
 		return
 	}
+	recordAudit(database.DB, c, models.AuditCreate, "menu_item", item.ID, nil, item)
 	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "Menu item created", Data: item})
 }
 
-// UpdateMenuItem updates an existing menu item
+// UpdateMenuItem updates an existing menu item from a full body (PUT) or a merge patch (PATCH)
 func UpdateMenuItem(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid item ID"})
 		return
 	}
-	var input menuItemInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
-		return
-	}
 	var item models.MenuItem
 	if err := database.DB.First(&item, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Menu item not found"})
 		return
 	}
-	database.DB.Model(&item).Updates(models.MenuItem{
-		MenuID:   input.MenuID,
-		ParentID: input.ParentID,
-		Title:    input.Title,
-		URL:      input.URL,
-		Order:    input.Order,
-		Class:    input.Class,
-		Target:   input.Target,
+	if !ifMatch(c, item.ID, item.Version) {
+		return
+	}
+	input := menuItemInput{
+		MenuID:   item.MenuID,
+		ParentID: item.ParentID,
+		Title:    item.Title,
+		URL:      item.URL,
+		Order:    item.Order,
+		Class:    item.Class,
+		Target:   item.Target,
+	}
+	if err := helpers.BindUpdate(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := item
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if input.MenuID != before.MenuID || !sameID(input.ParentID, before.ParentID) {
+			if err := checkMenuItemParent(tx, item.ID, input.MenuID, input.ParentID); err != nil {
+				return err
+			}
+		}
+		err := versioned(tx.Model(&item).Where("version = ?", before.Version).
+			Select("MenuID", "ParentID", "Title", "URL", "Order", "Class", "Target", "Version").
+			Updates(models.MenuItem{
+				Versioned: models.Versioned{Version: before.Version + 1},
+				MenuID:    input.MenuID,
+				ParentID:  input.ParentID,
+				Title:     input.Title,
+				URL:       input.URL,
+				Order:     input.Order,
+				Class:     input.Class,
+				Target:    input.Target,
+			}))
+		if err != nil {
+			return err
+		}
+		if input.MenuID == before.MenuID {
+			return touchMenuItems(tx, before.MenuID, before.ParentID, input.ParentID)
+		}
+		// the items below move to the other menu along with it
+		below, err := menuItemDescendants(tx, before.MenuID, item.ID)
+		if err != nil {
+			return err
+		}
+		if len(below) > 0 {
+			moved := map[string]interface{}{"menu_id": input.MenuID, "version": gorm.Expr("version + 1")}
+			if err := tx.Model(&models.MenuItem{}).Where("id IN ?", below).Updates(moved).Error; err != nil {
+				return err
+			}
+		}
+		if err := touchMenuItems(tx, before.MenuID, before.ParentID); err != nil {
+			return err
+		}
+		return touchMenuItems(tx, input.MenuID, input.ParentID)
 	})
+	if err != nil {
+		menuItemWriteError(c, err, item.ID, "Failed to update menu item")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditUpdate, "menu_item", item.ID, before, item)
+	c.Header("ETag", helpers.ETag(item.ID, item.Version))
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu item updated", Data: item})
 }
 
@@ -203,9 +312,50 @@ func DeleteMenuItem(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid item ID"})
 		return
 	}
-	if err := database.DB.Delete(&models.MenuItem{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to delete menu item", Data: err.Error()})
+	var item models.MenuItem
+	if err := database.DB.First(&item, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Menu item not found"})
+		return
+	}
+	if !ifMatch(c, item.ID, item.Version) {
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := versioned(tx.Where("version = ?", item.Version).Delete(&item)); err != nil {
+			return err
+		}
+		return touchMenuItems(tx, item.MenuID, item.ParentID)
+	})
+	if err != nil {
+		writeError(c, err, &models.MenuItem{}, item.ID, "Failed to delete menu item")
 		return
 	}
+	recordAudit(database.DB, c, models.AuditDelete, "menu_item", item.ID, item, nil)
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu item deleted"})
 }
+
+// touchMenus bumps the version of menus whose items changed, as a menu's representation includes them
+func touchMenus(db *gorm.DB, menuIDs ...uint) error {
+	return db.Model(&models.Menu{}).Where("id IN ?", menuIDs).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// touchMenuItems bumps the version of menu menuID and of the items parents and their ancestors
+// in it, after an item below them changed: their representations include their subtrees
+func touchMenuItems(tx *gorm.DB, menuID uint, parents ...*uint) error {
+	if err := touchMenus(tx, menuID); err != nil {
+		return err
+	}
+	var items []models.MenuItem
+	if err := tx.Select("id", "parent_id").Where("menu_id = ?", menuID).Find(&items).Error; err != nil {
+		return err
+	}
+	return touchItems(tx, menuItemAncestors(menuItemParents(items), parents...))
+}
+
+// touchItems bumps the version of the menu items ids
+func touchItems(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Model(&models.MenuItem{}).Where("id IN ?", ids).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errUnknownMenu       = errors.New("menu does not exist")
+	errUnknownParentItem = errors.New("parent item does not exist in this menu")
+	errMenuItemCycle     = errors.New("an item cannot be placed under itself or one of its descendants")
+)
+
+// menuTree nests items, all of one menu, below parent (nil for the top level), each level
+// ordered by Order. Items whose parent is missing, e.g. in the trash, are left out with
+// their descendants.
+func menuTree(items []models.MenuItem, parent *uint) []models.MenuItem {
+	children := map[uint][]models.MenuItem{} // by parent ID, 0 for the top level
+	for _, item := range items {
+		var key uint
+		if item.ParentID != nil {
+			key = *item.ParentID
+		}
+		children[key] = append(children[key], item)
+	}
+	for _, level := range children {
+		sort.SliceStable(level, func(i, j int) bool {
+			if level[i].Order != level[j].Order {
+				return level[i].Order < level[j].Order
+			}
+			return level[i].ID < level[j].ID
+		})
+	}
+
+	seen := map[uint]bool{} // guards against parent cycles
+	var nest func(parentID uint) []models.MenuItem
+	nest = func(parentID uint) []models.MenuItem {
+		level := []models.MenuItem{}
+		for _, item := range children[parentID] {
+			if seen[item.ID] {
+				continue
+			}
+			seen[item.ID] = true
+			item.Children = nest(item.ID)
+			level = append(level, item)
+		}
+		return level
+	}
+	if parent == nil {
+		return nest(0)
+	}
+	seen[*parent] = true
+	return nest(*parent)
+}
+
+// loadMenuTrees replaces the Items of menus with their item trees
+func loadMenuTrees(db *gorm.DB, menus []models.Menu) error {
+	if len(menus) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(menus))
+	for i, menu := range menus {
+		ids[i] = menu.ID
+	}
+	var items []models.MenuItem
+	if err := db.Where("menu_id IN ?", ids).Find(&items).Error; err != nil {
+		return err
+	}
+	byMenu := map[uint][]models.MenuItem{}
+	for _, item := range items {
+		byMenu[item.MenuID] = append(byMenu[item.MenuID], item)
+	}
+	for i := range menus {
+		menus[i].Items = menuTree(byMenu[menus[i].ID], nil)
+	}
+	return nil
+}
+
+// checkMenuItemParent checks that item id (0 for a new one) may be placed in menu menuID under
+// parentID: the menu exists, the parent belongs to it and is neither the item nor one of its
+// descendants. The ancestors are locked until tx ends, so concurrent moves cannot close a cycle.
+func checkMenuItemParent(tx *gorm.DB, id, menuID uint, parentID *uint) error {
+	var count int64
+	if err := tx.Model(&models.Menu{}).Where("id = ?", menuID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errUnknownMenu
+	}
+	if parentID == nil {
+		return nil
+	}
+	var parent models.MenuItem
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&parent, *parentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && parent.MenuID != menuID {
+		return errUnknownParentItem
+	}
+	if err != nil {
+		return err
+	}
+	seen := map[uint]bool{}
+	for ancestor := parent; ; {
+		if ancestor.ID == id {
+			return errMenuItemCycle
+		}
+		if ancestor.ParentID == nil || seen[ancestor.ID] {
+			return nil
+		}
+		seen[ancestor.ID] = true
+		next := *ancestor.ParentID
+		ancestor = models.MenuItem{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ancestor, next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// menuItemParents maps the ID of each of items to its parent ID
+func menuItemParents(items []models.MenuItem) map[uint]*uint {
+	parents := make(map[uint]*uint, len(items))
+	for _, item := range items {
+		parents[item.ID] = item.ParentID
+	}
+	return parents
+}
+
+// menuItemAncestors returns the items among ids and their ancestors along parentOf, each once
+func menuItemAncestors(parentOf map[uint]*uint, ids ...*uint) []uint {
+	seen := map[uint]bool{}
+	var ancestors []uint
+	for _, id := range ids {
+		for ; id != nil && !seen[*id]; id = parentOf[*id] {
+			seen[*id] = true
+			ancestors = append(ancestors, *id)
+		}
+	}
+	return ancestors
+}
+
+// menuItemDescendants returns the IDs of the items below item id in its menu
+func menuItemDescendants(tx *gorm.DB, menuID, id uint) ([]uint, error) {
+	var items []models.MenuItem
+	if err := tx.Select("id", "parent_id").Where("menu_id = ?", menuID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	var ids []uint
+	for _, item := range menuTreeFlat(menuTree(items, &id)) {
+		ids = append(ids, item.ID)
+	}
+	return ids, nil
+}
+
+// menuTreeFlat lists the items of a tree built by menuTree, parents before their children
+func menuTreeFlat(tree []models.MenuItem) []models.MenuItem {
+	var flat []models.MenuItem
+	for _, item := range tree {
+		flat = append(flat, item)
+		flat = append(flat, menuTreeFlat(item.Children)...)
+	}
+	return flat
+}
+
+// menuItemWriteError responds to an error from writing a menu item
+func menuItemWriteError(c *gin.Context, err error, id uint, message string) {
+	switch {
+	case errors.Is(err, errUnknownMenu):
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Menu does not exist"})
+	case errors.Is(err, errUnknownParentItem):
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Parent item must exist in the same menu"})
+	case errors.Is(err, errMenuItemCycle):
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "An item cannot be placed under itself or one of its descendants"})
+	default:
+		writeError(c, err, &models.MenuItem{}, id, message)
+	}
+}
+
+type menuLayoutInput struct {
+	// Items places every item of the menu; parent_id null puts an item at the top level
+	Items []menuLayoutEntry `json:"items" binding:"required,dive"`
+}
+
+type menuLayoutEntry struct {
+	ID       uint  `json:"id" binding:"required"`
+	ParentID *uint `json:"parent_id"`
+	Order    int   `json:"order"`
+}
+
+// layoutProblems lists, per kind of problem, the item IDs of a menu layout that have it
+type layoutProblems map[string][]uint
+
+func (p layoutProblems) Error() string {
+	return "invalid menu layout"
+}
+
+// ArrangeMenuItems moves and reorders the items of menu :id in one go, as for a drag-and-drop
+// editor. The body must place every item of the menu exactly once; nothing is changed unless
+// the whole layout is valid.
+func ArrangeMenuItems(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid menu ID"})
+		return
+	}
+	var input menuLayoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	var menu models.Menu
+	if err := database.DB.First(&menu, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Menu not found"})
+		return
+	}
+	if !ifMatch(c, menu.ID, menu.Version) {
+		return
+	}
+
+	var tree []models.MenuItem
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var items []models.MenuItem
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("menu_id = ?", menu.ID).Find(&items).Error
+		if err != nil {
+			return err
+		}
+		if err := checkMenuLayout(items, input.Items); err != nil {
+			return err
+		}
+		wanted := make(map[uint]menuLayoutEntry, len(input.Items))
+		newParents := make(map[uint]*uint, len(input.Items))
+		for _, entry := range input.Items {
+			wanted[entry.ID], newParents[entry.ID] = entry, entry.ParentID
+		}
+		before := make([]menuLayoutEntry, len(items))
+		var movedFrom, movedTo []*uint // parents whose subtrees change
+		for i, item := range items {
+			before[i] = menuLayoutEntry{ID: item.ID, ParentID: item.ParentID, Order: item.Order}
+			entry := wanted[item.ID]
+			if item.Order == entry.Order && sameID(item.ParentID, entry.ParentID) {
+				continue
+			}
+			layout := map[string]interface{}{"parent_id": entry.ParentID, "order": entry.Order, "version": gorm.Expr("version + 1")}
+			if err := tx.Model(&models.MenuItem{}).Where("id = ?", item.ID).Updates(layout).Error; err != nil {
+				return err
+			}
+			movedFrom, movedTo = append(movedFrom, item.ParentID), append(movedTo, entry.ParentID)
+		}
+		if len(movedTo) == 0 {
+			tree = menuTree(items, nil)
+			return nil
+		}
+		// items above a change, in the old layout or the new one, each once
+		touched := append(menuItemAncestors(menuItemParents(items), movedFrom...), menuItemAncestors(newParents, movedTo...)...)
+		if err := touchItems(tx, missingIDs(touched, nil)); err != nil {
+			return err
+		}
+		err = versioned(tx.Model(&menu).Where("version = ?", menu.Version).
+			Select("Version").Updates(models.Menu{Versioned: models.Versioned{Version: menu.Version + 1}}))
+		if err != nil {
+			return err
+		}
+		recordAudit(tx, c, "arrange", "menu", menu.ID, before, input.Items)
+		items = nil
+		if err := tx.Where("menu_id = ?", menu.ID).Find(&items).Error; err != nil {
+			return err
+		}
+		tree = menuTree(items, nil)
+		return nil
+	})
+	var problems layoutProblems
+	if errors.As(err, &problems) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Invalid menu layout", Data: problems})
+		return
+	}
+	if err != nil {
+		writeError(c, err, &models.Menu{}, menu.ID, "Failed to arrange menu items")
+		return
+	}
+	c.Header("ETag", helpers.ETag(menu.ID, menu.Version))
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Menu items arranged", Data: tree})
+}
+
+// checkMenuLayout checks that layout places each of items, the items of one menu, exactly once,
+// under another of them or at the top level, without cycles. It returns layoutProblems otherwise.
+func checkMenuLayout(items []models.MenuItem, layout []menuLayoutEntry) error {
+	inMenu := make(map[uint]bool, len(items))
+	for _, item := range items {
+		inMenu[item.ID] = true
+	}
+	problems := layoutProblems{}
+	parents := make(map[uint]*uint, len(layout))
+	for _, entry := range layout {
+		_, placed := parents[entry.ID]
+		switch {
+		case !inMenu[entry.ID]:
+			problems["foreign"] = append(problems["foreign"], entry.ID)
+		case placed:
+			problems["duplicate"] = append(problems["duplicate"], entry.ID)
+		default:
+			parents[entry.ID] = entry.ParentID
+		}
+		if entry.ParentID != nil && !inMenu[*entry.ParentID] {
+			problems["unknown_parent"] = append(problems["unknown_parent"], entry.ID)
+		}
+	}
+	for _, item := range items {
+		if _, placed := parents[item.ID]; !placed {
+			problems["missing"] = append(problems["missing"], item.ID)
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	// report the items on a cycle; those merely below one are fine once it is broken
+	for id := range parents {
+		seen := map[uint]bool{}
+		for parent := parents[id]; parent != nil && !seen[*parent]; parent = parents[*parent] {
+			if *parent == id {
+				problems["cycle"] = append(problems["cycle"], id)
+				break
+			}
+			seen[*parent] = true
+		}
+	}
+	if len(problems) > 0 {
+		sort.Slice(problems["cycle"], func(i, j int) bool { return problems["cycle"][i] < problems["cycle"][j] })
+		return problems
+	}
+	return nil
+}
@@ -1,74 +1,152 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"beres/helpers"
 	"beres/infra/database"
 	"beres/models"
+	"beres/routers/middleware"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // DTOs for binding
 type postInput struct {
-	Title         string `json:"title" binding:"required"`
-	Slug          string `json:"slug" binding:"required"`
-	Content       string `json:"content" binding:"required"`
-	Excerpt       string `json:"excerpt"`
-	AuthorID      uint   `json:"author_id" binding:"required"`
-	Status        string `json:"status"` // draft, publish, trash
-	FeaturedImage string `json:"featured_image"`
-	CategoryIDs   []uint `json:"category_ids"` // many-to-many links
-	TagIDs        []uint `json:"tag_ids"`
+	Title         string     `json:"title" binding:"required"`
+	Slug          string     `json:"slug"` // generated from the title when left out
+	Content       string     `json:"content" binding:"required"`
+	Excerpt       string     `json:"excerpt"`
+	AuthorID      uint       `json:"author_id" binding:"required"`
+	Status        string     `json:"status" binding:"omitempty,oneof=draft pending_review approved publish scheduled private"`
+	PublishAt     *time.Time `json:"publish_at"`   // required for scheduled posts
+	UnpublishAt   *time.Time `json:"unpublish_at"` // a published post returns to draft at this time
+	FeaturedImage string     `json:"featured_image"`
+	// Password protects the content; "" removes the protection and leaving it out keeps the current one
+	Password    *string `json:"password" binding:"omitempty,max=72"`
+	CategoryIDs []uint  `json:"category_ids"` // many-to-many links
+	TagIDs      []uint  `json:"tag_ids"`
 }
 
 type categoryInput struct {
 	Name        string `json:"name" binding:"required"`
-	Slug        string `json:"slug" binding:"required"`
+	Slug        string `json:"slug"` // generated from the name when left out
 	Description string `json:"description"`
 	ParentID    *uint  `json:"parent_id"`
 }
 
 type tagInput struct {
 	Name        string `json:"name" binding:"required"`
-	Slug        string `json:"slug" binding:"required"`
+	Slug        string `json:"slug"` // generated from the name when left out
 	Description string `json:"description"`
 }
 
+// list query parameters accepted by GetPosts, GetCategories and GetTags
+var postListOptions = helpers.ListOptions{
+	Sortable: map[string]string{"created_at": "created_at", "updated_at": "updated_at", "title": "title"},
+	Filters: map[string]helpers.Filter{
+		"status":    helpers.Equals("status"),
+		"author_id": helpers.Equals("author_id"),
+		"category":  postsInTaxonomy("posts_categories", "categories", "category_id"),
+		"tag":       postsInTaxonomy("posts_tags", "tags", "tag_id"),
+	},
+	DefaultSort: "-created_at",
+	Preload:     []string{"Author", "Categories", "Tags"},
+}
+
+var categoryListOptions = helpers.ListOptions{
+	Sortable:    map[string]string{"name": "name", "created_at": "created_at"},
+	Filters:     map[string]helpers.Filter{"parent_id": helpers.NullableEquals("parent_id")},
+	DefaultSort: "name",
+	Preload:     []string{"Children"},
+}
+
+var tagListOptions = helpers.ListOptions{
+	Sortable:    map[string]string{"name": "name", "created_at": "created_at"},
+	DefaultSort: "name",
+}
+
+// postsInTaxonomy filters posts linked through joinTable to the term with the given slug
+func postsInTaxonomy(joinTable, termTable, termColumn string) helpers.Filter {
+	return func(db *gorm.DB, slug string) (*gorm.DB, error) {
+		sub := db.Session(&gorm.Session{NewDB: true}).
+			Table(joinTable).
+			Select(joinTable+".post_id").
+			Joins("JOIN "+termTable+" ON "+termTable+".id = "+joinTable+"."+termColumn).
+			Where(termTable+".slug = ?", slug)
+		return db.Where("posts.id IN (?)", sub), nil
+	}
+}
+
 // ----- Posts Handlers -----
 
-// GetPosts lists all posts with related data
+// GetPosts lists the posts the caller may see with related data, one page at a time
 func GetPosts(c *gin.Context) {
 	var posts []models.Post
-	db := database.DB.
-		Preload("Author").
-		Preload("Categories").
-		Preload("Tags")
-	if err := db.Find(&posts).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch posts", Data: err.Error()})
+	meta, err := helpers.Paginate(c, database.DB.Scopes(readablePosts(c)), postListOptions, &posts)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch posts", Data: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Posts retrieved", Data: posts})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Posts retrieved", Data: posts, Meta: meta})
 }
 
-// GetPostByID fetches one post by its ID
+// GetPostByID fetches one post by its ID if the caller may see it
 func GetPostByID(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid post ID"})
 		return
 	}
+	showPost(c, database.DB.Where("posts.id = ?", id), "")
+}
+
+// GetPostBySlug fetches one post by its slug if the caller may see it, redirecting from a former slug
+func GetPostBySlug(c *gin.Context) {
+	showPost(c, database.DB.Where("posts.slug = ?", c.Param("slug")), "slug")
+}
+
+// showPost responds with the post matched by query, unlocking a password-protected one when its
+// password is sent. If there is none and slugParam is set, a former slug in that route parameter is redirected.
+func showPost(c *gin.Context, query *gorm.DB, slugParam string) {
 	var post models.Post
-	db := database.DB.
+	db := query.
+		Scopes(readablePosts(c)).
 		Preload("Author").
 		Preload("Categories").
 		Preload("Tags")
-	if err := db.First(&post, id).Error; err != nil {
+	if err := db.First(&post).Error; err != nil {
+		if slugParam != "" && postSlugs.redirect(c, database.DB.Scopes(visiblePosts(c)), slugParam) {
+			return
+		}
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Post not found"})
 		return
 	}
+	// readers unlock a password-protected post by sending its password in X-Post-Password
+	etag := helpers.ETag(post.ID, post.Version)
+	if password := c.GetHeader("X-Post-Password"); password != "" && post.PasswordProtected && !canReadProtected(c, post) {
+		if bcrypt.CompareHashAndPassword([]byte(post.PasswordHash), []byte(password)) != nil {
+			c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "Incorrect post password"})
+			return
+		}
+		if err := database.DB.Model(&models.Post{}).Select("content", "excerpt").Where("id = ?", post.ID).Take(&post).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch post", Data: err.Error()})
+			return
+		}
+	} else if post.PasswordProtected && !canReadProtected(c, post) {
+		etag = helpers.VariantETag(post.ID, post.Version, "redacted")
+	}
+	if notModifiedTag(c, etag) {
+		return
+	}
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Post retrieved", Data: post})
 }
 
@@ -79,82 +157,171 @@ func CreatePost(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
 		return
 	}
+	user := currentUser(c)
+	if input.AuthorID != user.ID && !middleware.Can(c, models.AbilityPostsEditOthers) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You may only create posts as yourself"})
+		return
+	}
+	if input.Status == "" {
+		input.Status = models.PostStatusDraft
+	}
+	if msg := checkSchedule(&input); msg != "" {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: msg})
+		return
+	}
+	// a new post starts out as a draft, which may be submitted right away
+	if _, ok := statusStep(c, models.PostStatusDraft, input.Status); !ok {
+		return
+	}
 	post := models.Post{
 		Title:         input.Title,
-		Slug:          input.Slug,
 		Content:       input.Content,
 		Excerpt:       input.Excerpt,
 		AuthorID:      input.AuthorID,
 		Status:        input.Status,
+		PublishAt:     input.PublishAt,
+		UnpublishAt:   input.UnpublishAt,
 		FeaturedImage: input.FeaturedImage,
 	}
-	if err := database.DB.Create(&post).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Creation failed", Data: err.Error()})
+	if input.Password != nil && *input.Password != "" {
+		post.PasswordHash = hashPostPassword(*input.Password)
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		cats, tags, err := loadPostLinks(tx, input)
+		if err != nil {
+			return err
+		}
+		if post.Slug, err = postSlugs.choose(tx, input.Slug, "", input.Title, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		if err := replacePostTerms(tx, &post, cats, tags); err != nil {
+			return err
+		}
+		// Return full post
+		if err := tx.Preload("Author").Preload("Categories").Preload("Tags").First(&post, post.ID).Error; err != nil {
+			return err
+		}
+		recordRevision(tx, c, post)
+		recordTransition(tx, c, post.ID, models.AuditCreate, "", post.Status, "")
+		recordAudit(tx, c, models.AuditCreate, "post", post.ID, nil, post)
+		return nil
+	})
+	if err != nil {
+		postWriteError(c, err, 0, "Creation failed")
 		return
 	}
-	// Load associations by IDs
-	var cats []models.Category
-	database.DB.Find(&cats, input.CategoryIDs)
-	database.DB.Model(&post).Association("Categories").Replace(cats) // many2many join
-
-	var tags []models.Tag
-	database.DB.Find(&tags, input.TagIDs)
-	database.DB.Model(&post).Association("Tags").Replace(tags)
-
-	// Return full post
-	database.DB.
-		Preload("Author").
-		Preload("Categories").
-		Preload("Tags").
-		First(&post, post.ID)
-
+	reindexPost(post.ID)
 	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "Post created", Data: post})
 }
 
-// UpdatePost updates a post and its many-to-many links
+// UpdatePost updates a post and its many-to-many links from a full body (PUT) or a merge patch (PATCH)
 func UpdatePost(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid post ID"})
 		return
 	}
-	var input postInput
-	if err := c.ShouldBindJSON(&input); err != nil {
+	var post models.Post
+	if err := database.DB.Preload("Categories").Preload("Tags").First(&post, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Post not found"})
+		return
+	}
+	if !canTouchPost(c, post, models.AbilityPostsEditOthers) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You may only edit your own posts"})
+		return
+	}
+	if !ifMatch(c, post.ID, post.Version) {
+		return
+	}
+	input := postInputOf(post)
+	if err := helpers.BindUpdate(c, &input); err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
 		return
 	}
-	var post models.Post
-	if err := database.DB.First(&post, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Post not found"})
+	if input.AuthorID != post.AuthorID && !middleware.Can(c, models.AbilityPostsEditOthers) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You may not hand your posts to another author", Data: gin.H{"required_ability": models.AbilityPostsEditOthers}})
 		return
 	}
-	// Update fields
-	updates := map[string]interface{}{
-		"Title":         input.Title,
-		"Slug":          input.Slug,
-		"Content":       input.Content,
-		"Excerpt":       input.Excerpt,
-		"Status":        input.Status,
-		"FeaturedImage": input.FeaturedImage,
+	if input.Status == "" {
+		input.Status = post.Status
 	}
-	database.DB.Model(&post).Updates(updates) // update columns
-
-	// Replace associations
-	var cats []models.Category
-	database.DB.Find(&cats, input.CategoryIDs)
-	database.DB.Model(&post).Association("Categories").Replace(cats)
-
-	var tags []models.Tag
-	database.DB.Find(&tags, input.TagIDs)
-	database.DB.Model(&post).Association("Tags").Replace(tags)
-
-	// Return updated post
-	database.DB.
-		Preload("Author").
-		Preload("Categories").
-		Preload("Tags").
-		First(&post, post.ID)
-
+	// republishing keeps the original publication time
+	if input.PublishAt == nil && input.Status == models.PostStatusPublish {
+		input.PublishAt = post.PublishAt
+	}
+	action := models.AuditUpdate
+	if input.Status == post.Status && needsReview(c, post, input) {
+		input.Status, action = models.PostStatusPendingReview, models.WorkflowResubmit
+	}
+	if msg := checkSchedule(&input); msg != "" {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: msg})
+		return
+	}
+	if action != models.WorkflowResubmit && input.Status != post.Status {
+		step, ok := statusStep(c, post.Status, input.Status)
+		if !ok {
+			return
+		}
+		if step != "" {
+			action = step
+		}
+	}
+	before := post
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		cats, tags, err := loadPostLinks(tx, input)
+		if err != nil {
+			return err
+		}
+		slug, err := postSlugs.choose(tx, input.Slug, post.Slug, input.Title, post.ID)
+		if err != nil {
+			return err
+		}
+		recordBaselineRevision(tx, post)
+		// Update fields
+		updates := map[string]interface{}{
+			"Title":         input.Title,
+			"Slug":          slug,
+			"Content":       input.Content,
+			"Excerpt":       input.Excerpt,
+			"AuthorID":      input.AuthorID,
+			"Status":        input.Status,
+			"PublishAt":     input.PublishAt,
+			"UnpublishAt":   input.UnpublishAt,
+			"FeaturedImage": input.FeaturedImage,
+			"Version":       before.Version + 1,
+		}
+		if input.Password != nil {
+			updates["PasswordHash"] = hashPostPassword(*input.Password)
+		}
+		if err := versioned(tx.Model(&post).Where("version = ?", before.Version).Updates(updates)); err != nil {
+			return err
+		}
+		if err := postSlugs.claim(tx, post.ID, before.Slug, slug); err != nil {
+			return err
+		}
+		if err := replacePostTerms(tx, &post, cats, tags); err != nil {
+			return err
+		}
+		// Return updated post
+		if err := tx.Preload("Author").Preload("Categories").Preload("Tags").First(&post, post.ID).Error; err != nil {
+			return err
+		}
+		recordRevision(tx, c, post)
+		if post.Status != before.Status {
+			recordTransition(tx, c, post.ID, action, before.Status, post.Status, "")
+		}
+		recordAudit(tx, c, models.AuditUpdate, "post", post.ID, before, post)
+		return nil
+	})
+	if err != nil {
+		postWriteError(c, err, post.ID, "Update failed")
+		return
+	}
+	reindexPost(post.ID)
+	c.Header("ETag", helpers.ETag(post.ID, post.Version))
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Post updated", Data: post})
 }
 
@@ -165,24 +332,287 @@ func DeletePost(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid post ID"})
 		return
 	}
-	if err := database.DB.Delete(&models.Post{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Deletion failed", Data: err.Error()})
+	var post models.Post
+	if err := database.DB.First(&post, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Post not found"})
+		return
+	}
+	if !canTouchPost(c, post, models.AbilityPostsDeleteOthers) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You may only delete your own posts"})
 		return
 	}
+	if !ifMatch(c, post.ID, post.Version) {
+		return
+	}
+	if err := versioned(database.DB.Where("version = ?", post.Version).Delete(&post)); err != nil {
+		writeError(c, err, &models.Post{}, post.ID, "Deletion failed")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditDelete, "post", post.ID, post, nil)
+	reindexPost(post.ID)
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Post deleted"})
 }
 
+// canTouchPost reports whether the current user owns post or holds othersAbility
+func canTouchPost(c *gin.Context, post models.Post, othersAbility string) bool {
+	return post.AuthorID == currentUser(c).ID || middleware.Can(c, othersAbility)
+}
+
+// canSetStatus reports whether the current user may move a post into status outside the
+// editorial workflow, writing a 403 response if not. Publishing needs posts:publish.
+func canSetStatus(c *gin.Context, status string) bool {
+	switch status {
+	case models.PostStatusPublish, models.PostStatusScheduled, models.PostStatusPrivate:
+	default:
+		return true
+	}
+	if middleware.Can(c, models.AbilityPostsPublish) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You are not allowed to move posts to " + status, Data: gin.H{"required_ability": models.AbilityPostsPublish}})
+	return false
+}
+
+// checkSchedule validates the publication times of input, stamping posts published now,
+// scheduling those published with a future publish_at and publishing those scheduled for a
+// time that has passed. It returns a message describing a problem, or "".
+func checkSchedule(input *postInput) string {
+	now := time.Now()
+	switch input.Status {
+	case models.PostStatusScheduled:
+		if input.PublishAt == nil {
+			return "publish_at is required for scheduled posts"
+		}
+		if !input.PublishAt.After(now) {
+			input.Status = models.PostStatusPublish
+		}
+	case models.PostStatusPublish:
+		if input.PublishAt == nil {
+			input.PublishAt = &now
+		} else if input.PublishAt.After(now) {
+			input.Status = models.PostStatusScheduled
+		}
+	default:
+		return ""
+	}
+	if input.UnpublishAt != nil && (!input.UnpublishAt.After(*input.PublishAt) || !input.UnpublishAt.After(now)) {
+		return "unpublish_at must be in the future and after publish_at"
+	}
+	return ""
+}
+
+// livePost matches published posts within their publication window
+const livePost = "posts.status = ? AND (posts.publish_at IS NULL OR posts.publish_at <= ?) AND (posts.unpublish_at IS NULL OR posts.unpublish_at > ?)"
+
+// visiblePosts limits a post query to what the caller may read. Editors (posts:edit_others) see
+// every post, signed-in users also see their own posts in any status, reviewers (posts:review) see
+// posts in review, and everyone sees live published posts.
+func visiblePosts(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if middleware.Can(c, models.AbilityPostsEditOthers) {
+			return db
+		}
+		now := time.Now()
+		if user, ok := c.Get("current_user"); ok {
+			if middleware.Can(c, models.AbilityPostsReview) {
+				return db.Where("("+livePost+") OR posts.author_id = ? OR posts.status IN ?", models.PostStatusPublish, now, now, user.(models.User).ID, inReview)
+			}
+			return db.Where("("+livePost+") OR posts.author_id = ?", models.PostStatusPublish, now, now, user.(models.User).ID)
+		}
+		return db.Where(livePost, models.PostStatusPublish, now, now)
+	}
+}
+
+// readablePosts is visiblePosts for queries that load posts: it also blanks the content and excerpt
+// of the password-protected posts the caller may not read without the password.
+func readablePosts(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(visiblePosts(c))
+		// a query choosing its own columns, such as a count, has no content to blank
+		if _, ok := db.Statement.Clauses["SELECT"]; ok || len(db.Statement.Selects) > 0 || middleware.Can(c, models.AbilityPostsEditOthers) {
+			return db
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(&models.Post{}); err != nil {
+			db.AddError(err)
+			return db
+		}
+		readable, args := protectedReadable(c)
+		columns := make([]string, 0, len(stmt.Schema.DBNames))
+		var vars []interface{}
+		for _, name := range stmt.Schema.DBNames {
+			if name == "content" || name == "excerpt" {
+				columns = append(columns, "CASE WHEN COALESCE(posts.password_hash, '') = '' OR ("+readable+") THEN posts."+name+" ELSE '' END AS "+name)
+				vars = append(vars, args...)
+				continue
+			}
+			columns = append(columns, "posts."+name)
+		}
+		return db.Clauses(clause.Select{Expression: clause.Expr{SQL: strings.Join(columns, ", "), Vars: vars}})
+	}
+}
+
+// canReadProtected reports whether the caller may read a password-protected post without its password
+func canReadProtected(c *gin.Context, post models.Post) bool {
+	if user, ok := c.Get("current_user"); ok && user.(models.User).ID == post.AuthorID {
+		return true
+	}
+	if isInReview(post.Status) && middleware.Can(c, models.AbilityPostsReview) {
+		return true
+	}
+	return middleware.Can(c, models.AbilityPostsEditOthers)
+}
+
+// protectedReadable is canReadProtected as a condition on posts, for queries over many posts
+func protectedReadable(c *gin.Context) (string, []interface{}) {
+	if middleware.Can(c, models.AbilityPostsEditOthers) {
+		return "1 = 1", nil
+	}
+	user, ok := c.Get("current_user")
+	if !ok {
+		return "1 = 0", nil
+	}
+	if middleware.Can(c, models.AbilityPostsReview) {
+		return "posts.author_id = ? OR posts.status IN ?", []interface{}{user.(models.User).ID, inReview}
+	}
+	return "posts.author_id = ?", []interface{}{user.(models.User).ID}
+}
+
+// hashPostPassword hashes a post password; the empty password removes the protection
+func hashPostPassword(password string) string {
+	if password == "" {
+		return ""
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash)
+}
+
+// postInputOf is the input that would leave post as it is, the base of a merge patch
+func postInputOf(post models.Post) postInput {
+	input := postInput{
+		Title:         post.Title,
+		Slug:          post.Slug,
+		Content:       post.Content,
+		Excerpt:       post.Excerpt,
+		AuthorID:      post.AuthorID,
+		Status:        post.Status,
+		PublishAt:     post.PublishAt,
+		UnpublishAt:   post.UnpublishAt,
+		FeaturedImage: post.FeaturedImage,
+		CategoryIDs:   make([]uint, len(post.Categories)),
+		TagIDs:        make([]uint, len(post.Tags)),
+	}
+	for i, cat := range post.Categories {
+		input.CategoryIDs[i] = cat.ID
+	}
+	for i, t := range post.Tags {
+		input.TagIDs[i] = t.ID
+	}
+	return input
+}
+
+// unknownRefs lists, per input field, the IDs that match no row
+type unknownRefs map[string][]uint
+
+func (u unknownRefs) Error() string {
+	return "unknown references"
+}
+
+// loadPostLinks loads the categories and tags input links the post to. It returns unknownRefs
+// if the author or any of them does not exist.
+func loadPostLinks(tx *gorm.DB, input postInput) ([]models.Category, []models.Tag, error) {
+	unknown := unknownRefs{}
+	var authors int64
+	if err := tx.Model(&models.User{}).Where("id = ?", input.AuthorID).Count(&authors).Error; err != nil {
+		return nil, nil, err
+	}
+	if authors == 0 {
+		unknown["author_id"] = []uint{input.AuthorID}
+	}
+
+	var cats []models.Category
+	if len(input.CategoryIDs) > 0 {
+		if err := tx.Find(&cats, input.CategoryIDs).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	found := make([]uint, len(cats))
+	for i, cat := range cats {
+		found[i] = cat.ID
+	}
+	if missing := missingIDs(input.CategoryIDs, found); len(missing) > 0 {
+		unknown["category_ids"] = missing
+	}
+
+	var tags []models.Tag
+	if len(input.TagIDs) > 0 {
+		if err := tx.Find(&tags, input.TagIDs).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	found = make([]uint, len(tags))
+	for i, t := range tags {
+		found[i] = t.ID
+	}
+	if missing := missingIDs(input.TagIDs, found); len(missing) > 0 {
+		unknown["tag_ids"] = missing
+	}
+
+	if len(unknown) > 0 {
+		return nil, nil, unknown
+	}
+	return cats, tags, nil
+}
+
+// missingIDs returns the IDs of want that are not in found, each once
+func missingIDs(want, found []uint) []uint {
+	seen := make(map[uint]bool, len(found))
+	for _, id := range found {
+		seen[id] = true
+	}
+	var missing []uint
+	for _, id := range want {
+		if !seen[id] {
+			seen[id] = true
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// replacePostTerms makes cats and tags the post's only categories and tags
+func replacePostTerms(tx *gorm.DB, post *models.Post, cats []models.Category, tags []models.Tag) error {
+	if err := tx.Model(post).Association("Categories").Replace(cats); err != nil {
+		return err
+	}
+	return tx.Model(post).Association("Tags").Replace(tags)
+}
+
+// postWriteError responds to the error that rolled back the create or update of post id
+func postWriteError(c *gin.Context, err error, id uint, message string) {
+	var unknown unknownRefs
+	switch {
+	case errors.As(err, &unknown):
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Unknown author, category or tag IDs", Data: unknown})
+	case isSlugError(err):
+		slugError(c, err)
+	default:
+		writeError(c, err, &models.Post{}, id, message)
+	}
+}
+
 // ----- Category Handlers -----
 
-// GetCategories returns all categories (including children)
+// GetCategories lists categories (including children), one page at a time
 func GetCategories(c *gin.Context) {
 	var categories []models.Category
-	db := database.DB.Preload("Children")
-	if err := db.Find(&categories).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch categories", Data: err.Error()})
+	meta, err := helpers.Paginate(c, database.DB, categoryListOptions, &categories)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch categories", Data: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Categories retrieved", Data: categories})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Categories retrieved", Data: categories, Meta: meta})
 }
 
 // GetCategoryByID returns a single category by ID
@@ -197,9 +627,41 @@ func GetCategoryByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Category not found"})
 		return
 	}
+	if notModified(c, category.ID, category.Version) {
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Category retrieved", Data: category})
+}
+
+// GetCategoryBySlug returns a single category by slug
+func GetCategoryBySlug(c *gin.Context) {
+	var category models.Category
+	if err := database.DB.Preload("Children").Where("slug = ?", c.Param("slug")).First(&category).Error; err != nil {
+		if categorySlugs.redirect(c, database.DB, "slug") {
+			return
+		}
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Category not found"})
+		return
+	}
+	if notModified(c, category.ID, category.Version) {
+		return
+	}
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Category retrieved", Data: category})
 }
 
+// GetCategoryPosts lists the visible posts filed under the category named by :id, a slug or an ID
+func GetCategoryPosts(c *gin.Context) {
+	var category models.Category
+	if err := firstBySlugOrID(database.DB, &category, c.Param("id")); err != nil {
+		if categorySlugs.redirect(c, database.DB, "id") {
+			return
+		}
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Category not found"})
+		return
+	}
+	listTermPosts(c, postListOptions.Filters["category"], category.Slug)
+}
+
 // CreateCategory creates a new category
 func CreateCategory(c *gin.Context) {
 	var input categoryInput
@@ -209,40 +671,95 @@ func CreateCategory(c *gin.Context) {
 	}
 	category := models.Category{
 		Name:        input.Name,
-		Slug:        input.Slug,
 		Description: input.Description,
 		ParentID:    input.ParentID,
 	}
-	if err := database.DB.Create(&category).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to create category", Data: err.Error()})
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkCategoryParent(tx, 0, input.ParentID); err != nil {
+			return err
+		}
+		var err error
+		if category.Slug, err = categorySlugs.choose(tx, input.Slug, "", input.Name, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&category).Error; err != nil {
+			return err
+		}
+		if err := touchCategories(tx, category.ParentID); err != nil {
+			return err
+		}
+		recordAudit(tx, c, models.AuditCreate, "category", category.ID, nil, category)
+		return nil
+	})
+	if err != nil {
+		categoryWriteError(c, err, 0, "Failed to create category")
 		return
 	}
 	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "Category created", Data: category})
 }
 
-// UpdateCategory updates an existing category
+// UpdateCategory updates an existing category from a full body (PUT) or a merge patch (PATCH)
 func UpdateCategory(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid category ID"})
 		return
 	}
-	var input categoryInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
-		return
-	}
 	var category models.Category
 	if err := database.DB.First(&category, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Category not found"})
 		return
 	}
-	database.DB.Model(&category).Updates(models.Category{
-		Name:        input.Name,
-		Slug:        input.Slug,
-		Description: input.Description,
-		ParentID:    input.ParentID,
+	if !ifMatch(c, category.ID, category.Version) {
+		return
+	}
+	input := categoryInput{Name: category.Name, Slug: category.Slug, Description: category.Description, ParentID: category.ParentID}
+	if err := helpers.BindUpdate(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := category
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// a new parent_id moves the category, see MoveCategory
+		if !sameID(input.ParentID, before.ParentID) {
+			if err := checkCategoryParent(tx, category.ID, input.ParentID); err != nil {
+				return err
+			}
+		}
+		slug, err := categorySlugs.choose(tx, input.Slug, before.Slug, input.Name, category.ID)
+		if err != nil {
+			return err
+		}
+		err = versioned(tx.Model(&category).Where("version = ?", before.Version).
+			Select("Name", "Slug", "Description", "ParentID", "Version").
+			Updates(models.Category{
+				Versioned:   models.Versioned{Version: before.Version + 1},
+				Name:        input.Name,
+				Slug:        slug,
+				Description: input.Description,
+				ParentID:    input.ParentID,
+			}))
+		if err != nil {
+			return err
+		}
+		if err := categorySlugs.claim(tx, category.ID, before.Slug, slug); err != nil {
+			return err
+		}
+		if err := touchCategories(tx, before.ParentID, input.ParentID); err != nil {
+			return err
+		}
+		if err := categoryTaxonomy.touchLinked(tx, category.ID); err != nil {
+			return err
+		}
+		recordAudit(tx, c, models.AuditUpdate, "category", category.ID, before, category)
+		return nil
 	})
+	if err != nil {
+		categoryWriteError(c, err, category.ID, "Failed to update category")
+		return
+	}
+	reindexPostsOf("posts_categories", "category_id", category.ID)
+	c.Header("ETag", helpers.ETag(category.ID, category.Version))
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Category updated", Data: category})
 }
 
@@ -253,23 +770,44 @@ func DeleteCategory(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid category ID"})
 		return
 	}
-	if err := database.DB.Delete(&models.Category{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to delete category", Data: err.Error()})
+	var category models.Category
+	if err := database.DB.First(&category, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Category not found"})
+		return
+	}
+	if !ifMatch(c, category.ID, category.Version) {
 		return
 	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := versioned(tx.Where("version = ?", category.Version).Delete(&category)); err != nil {
+			return err
+		}
+		if err := touchCategories(tx, category.ParentID); err != nil {
+			return err
+		}
+		return categoryTaxonomy.touchLinked(tx, category.ID)
+	})
+	if err != nil {
+		writeError(c, err, &models.Category{}, category.ID, "Failed to delete category")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditDelete, "category", category.ID, category, nil)
+	reindexPostsOf("posts_categories", "category_id", category.ID)
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Category deleted"})
 }
 
 // ----- Tag Handlers -----
 
-// GetTags returns all tags
+// GetTags lists tags, one page at a time
 func GetTags(c *gin.Context) {
 	var tags []models.Tag
-	if err := database.DB.Find(&tags).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch tags", Data: err.Error()})
+	meta, err := helpers.Paginate(c, database.DB, tagListOptions, &tags)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch tags", Data: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tags retrieved", Data: tags})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tags retrieved", Data: tags, Meta: meta})
 }
 
 // GetTagByID returns a single tag by ID
@@ -284,9 +822,65 @@ func GetTagByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Tag not found"})
 		return
 	}
+	if notModified(c, tag.ID, tag.Version) {
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tag retrieved", Data: tag})
+}
+
+// GetTagBySlug returns a single tag by slug
+func GetTagBySlug(c *gin.Context) {
+	var tag models.Tag
+	if err := database.DB.Where("slug = ?", c.Param("slug")).First(&tag).Error; err != nil {
+		if tagSlugs.redirect(c, database.DB, "slug") {
+			return
+		}
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Tag not found"})
+		return
+	}
+	if notModified(c, tag.ID, tag.Version) {
+		return
+	}
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tag retrieved", Data: tag})
 }
 
+// GetTagPosts lists the visible posts carrying the tag named by :id, a slug or an ID
+func GetTagPosts(c *gin.Context) {
+	var tag models.Tag
+	if err := firstBySlugOrID(database.DB, &tag, c.Param("id")); err != nil {
+		if tagSlugs.redirect(c, database.DB, "id") {
+			return
+		}
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Tag not found"})
+		return
+	}
+	listTermPosts(c, postListOptions.Filters["tag"], tag.Slug)
+}
+
+// listTermPosts responds with one page of the visible posts that inTerm matches for slug
+func listTermPosts(c *gin.Context, inTerm helpers.Filter, slug string) {
+	db, _ := inTerm(database.DB.Scopes(readablePosts(c)), slug)
+	var posts []models.Post
+	meta, err := helpers.Paginate(c, db, postListOptions, &posts)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch posts", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Posts retrieved", Data: posts, Meta: meta})
+}
+
+// firstBySlugOrID loads into dest the row whose slug is value or, failing that, whose ID is value
+func firstBySlugOrID(db *gorm.DB, dest interface{}, value string) error {
+	err := db.Where("slug = ?", value).First(dest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if id, perr := strconv.ParseUint(value, 10, 64); perr == nil {
+			return db.First(dest, id).Error
+		}
+	}
+	return err
+}
+
 // CreateTag creates a new tag
 func CreateTag(c *gin.Context) {
 	var input tagInput
@@ -294,35 +888,84 @@ func CreateTag(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
 		return
 	}
-	tag := models.Tag{Name: input.Name, Slug: input.Slug, Description: input.Description}
-	if err := database.DB.Create(&tag).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to create tag", Data: err.Error()})
+	tag := models.Tag{Name: input.Name, Description: input.Description}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if tag.Slug, err = tagSlugs.choose(tx, input.Slug, "", input.Name, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&tag).Error; err != nil {
+			return err
+		}
+		recordAudit(tx, c, models.AuditCreate, "tag", tag.ID, nil, tag)
+		return nil
+	})
+	if err != nil {
+		tagWriteError(c, err, 0, "Failed to create tag")
 		return
 	}
 	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "Tag created", Data: tag})
 }
 
-// UpdateTag updates an existing tag
+// UpdateTag updates an existing tag from a full body (PUT) or a merge patch (PATCH)
 func UpdateTag(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid tag ID"})
 		return
 	}
-	var input tagInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
-		return
-	}
 	var tag models.Tag
 	if err := database.DB.First(&tag, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Tag not found"})
 		return
 	}
-	database.DB.Model(&tag).Updates(models.Tag{Name: input.Name, Slug: input.Slug, Description: input.Description})
+	if !ifMatch(c, tag.ID, tag.Version) {
+		return
+	}
+	input := tagInput{Name: tag.Name, Slug: tag.Slug, Description: tag.Description}
+	if err := helpers.BindUpdate(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := tag
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		slug, err := tagSlugs.choose(tx, input.Slug, before.Slug, input.Name, tag.ID)
+		if err != nil {
+			return err
+		}
+		err = versioned(tx.Model(&tag).Where("version = ?", before.Version).
+			Select("Name", "Slug", "Description", "Version").
+			Updates(models.Tag{Versioned: models.Versioned{Version: before.Version + 1}, Name: input.Name, Slug: slug, Description: input.Description}))
+		if err != nil {
+			return err
+		}
+		if err := tagSlugs.claim(tx, tag.ID, before.Slug, slug); err != nil {
+			return err
+		}
+		if err := tagTaxonomy.touchLinked(tx, tag.ID); err != nil {
+			return err
+		}
+		recordAudit(tx, c, models.AuditUpdate, "tag", tag.ID, before, tag)
+		return nil
+	})
+	if err != nil {
+		tagWriteError(c, err, tag.ID, "Failed to update tag")
+		return
+	}
+	reindexPostsOf("posts_tags", "tag_id", tag.ID)
+	c.Header("ETag", helpers.ETag(tag.ID, tag.Version))
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tag updated", Data: tag})
 }
 
+// tagWriteError responds to the error that rolled back the create or update of tag id
+func tagWriteError(c *gin.Context, err error, id uint, message string) {
+	if isSlugError(err) {
+		slugError(c, err)
+		return
+	}
+	writeError(c, err, &models.Tag{}, id, message)
+}
+
 // DeleteTag deletes a tag by ID
 func DeleteTag(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -330,9 +973,25 @@ func DeleteTag(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid tag ID"})
 		return
 	}
-	if err := database.DB.Delete(&models.Tag{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to delete tag", Data: err.Error()})
+	var tag models.Tag
+	if err := database.DB.First(&tag, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Tag not found"})
+		return
+	}
+	if !ifMatch(c, tag.ID, tag.Version) {
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := versioned(tx.Where("version = ?", tag.Version).Delete(&tag)); err != nil {
+			return err
+		}
+		return tagTaxonomy.touchLinked(tx, tag.ID)
+	})
+	if err != nil {
+		writeError(c, err, &models.Tag{}, tag.ID, "Failed to delete tag")
 		return
 	}
+	recordAudit(database.DB, c, models.AuditDelete, "tag", tag.ID, tag, nil)
+	reindexPostsOf("posts_tags", "tag_id", tag.ID)
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tag deleted"})
 }
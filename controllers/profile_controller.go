@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/infra/logger"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// DTOs for binding
+type profileInput struct {
+	Name  string `json:"name" binding:"required,max=255"`
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+type changePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Password        string `json:"password" binding:"required,min=8"`
+}
+
+type avatarInput struct {
+	AvatarURL string `json:"avatar_url" binding:"omitempty,url,max=255"` // empty removes the avatar
+}
+
+// GetProfile returns the current user
+func GetProfile(c *gin.Context) {
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Profile retrieved", Data: currentUser(c)})
+}
+
+// UpdateProfile changes the current user's name and email from a full body (PUT) or a merge patch
+// (PATCH); a new email must be verified again
+func UpdateProfile(c *gin.Context) {
+	user := currentUser(c)
+	input := profileInput{Name: user.Name, Email: user.Email}
+	if err := helpers.BindUpdate(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := user
+	emailChanged := input.Email != user.Email
+	updates := map[string]interface{}{"Name": input.Name, "Email": input.Email}
+	if emailChanged {
+		updates["EmailVerifiedAt"] = nil
+	}
+	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		userWriteError(c, err, "Failed to update profile")
+		return
+	}
+	if emailChanged {
+		if err := sendVerificationEmail(user); err != nil {
+			logger.Errorf("verification mail for user %d failed: %v", user.ID, err)
+		}
+	}
+	recordAudit(database.DB, c, models.AuditUpdate, "user", user.ID, before, user)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Profile updated", Data: user})
+}
+
+// ChangePassword sets a new password after checking the current one and signs out every other session
+func ChangePassword(c *gin.Context) {
+	var input changePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	user := currentUser(c)
+	if !checkPassword(user, input.CurrentPassword) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Current password is incorrect"})
+		return
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	current := c.MustGet("current_token").(models.PersonalAccessToken)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_hash", string(hash)).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND id <> ?", user.ID, current.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", user.ID, current.FamilyID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to change password", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, "password_change", "user", user.ID, nil, nil)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Password changed"})
+}
+
+// UpdateAvatar sets or clears the current user's avatar URL
+func UpdateAvatar(c *gin.Context) {
+	var input avatarInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	user := currentUser(c)
+	before := user
+	if err := database.DB.Model(&user).Update("avatar_url", input.AvatarURL).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to update avatar", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, models.AuditUpdate, "user", user.ID, before, user)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Avatar updated", Data: user})
+}
@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/infra/logger"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var revisionListOptions = helpers.ListOptions{
+	Sortable:    map[string]string{"created_at": "created_at"},
+	DefaultSort: "-id",
+}
+
+// GetPostRevisions lists a post's revisions, newest first, without their content
+func GetPostRevisions(c *gin.Context) {
+	post, ok := findRevisablePost(c)
+	if !ok {
+		return
+	}
+	var revisions []models.PostRevision
+	meta, err := helpers.Paginate(c, database.DB.Where("post_id = ?", post.ID).Omit("content"), revisionListOptions, &revisions)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch revisions", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Revisions retrieved", Data: revisions, Meta: meta})
+}
+
+// GetPostRevision returns one revision in full
+func GetPostRevision(c *gin.Context) {
+	post, ok := findRevisablePost(c)
+	if !ok {
+		return
+	}
+	revision, ok := findRevision(c, post.ID, c.Param("revision_id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Revision retrieved", Data: revision})
+}
+
+// ComparePostRevisions diffs revision ?from against revision ?to: a line diff of the content
+// and the old and new values of every other field that changed
+func ComparePostRevisions(c *gin.Context) {
+	post, ok := findRevisablePost(c)
+	if !ok {
+		return
+	}
+	from, ok := findRevision(c, post.ID, c.Query("from"))
+	if !ok {
+		return
+	}
+	to, ok := findRevision(c, post.ID, c.Query("to"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Revisions compared", Data: gin.H{
+		"from":    from.ID,
+		"to":      to.ID,
+		"fields":  helpers.JSONDiff(revisionFields(from), revisionFields(to)),
+		"content": helpers.LineDiff(from.Content, to.Content),
+	}})
+}
+
+// RestorePostRevision makes a revision's title, slug, content, excerpt, image, categories and tags
+// current again. Author and status stay as they are, unless the restore must be reviewed again
+// (see needsReview). The result is recorded as a new revision.
+func RestorePostRevision(c *gin.Context) {
+	post, ok := findRevisablePost(c)
+	if !ok {
+		return
+	}
+	revision, ok := findRevision(c, post.ID, c.Param("revision_id"))
+	if !ok {
+		return
+	}
+	if !ifMatch(c, post.ID, post.Version) {
+		return
+	}
+	var categoryIDs, tagIDs []uint
+	_ = json.Unmarshal(revision.CategoryIDs, &categoryIDs)
+	_ = json.Unmarshal(revision.TagIDs, &tagIDs)
+	next := postInputOf(post)
+	next.Title, next.Slug, next.Content, next.Excerpt, next.FeaturedImage = revision.Title, revision.Slug, revision.Content, revision.Excerpt, revision.FeaturedImage
+	next.CategoryIDs, next.TagIDs = categoryIDs, tagIDs
+	resubmit := needsReview(c, post, next)
+	before := post
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// the revision's slug may have gone to another post since
+		slug, err := postSlugs.choose(tx, revision.Slug, post.Slug, revision.Title, post.ID)
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"Title":         revision.Title,
+			"Slug":          slug,
+			"Content":       revision.Content,
+			"Excerpt":       revision.Excerpt,
+			"FeaturedImage": revision.FeaturedImage,
+			"Version":       before.Version + 1,
+		}
+		if resubmit {
+			updates["Status"] = models.PostStatusPendingReview
+		}
+		if err := versioned(tx.Model(&post).Where("version = ?", before.Version).Updates(updates)); err != nil {
+			return err
+		}
+		if err := postSlugs.claim(tx, post.ID, before.Slug, slug); err != nil {
+			return err
+		}
+		// terms deleted since the revision was taken are left out
+		var cats []models.Category
+		if len(categoryIDs) > 0 {
+			if err := tx.Find(&cats, categoryIDs).Error; err != nil {
+				return err
+			}
+		}
+		var tags []models.Tag
+		if len(tagIDs) > 0 {
+			if err := tx.Find(&tags, tagIDs).Error; err != nil {
+				return err
+			}
+		}
+		if err := replacePostTerms(tx, &post, cats, tags); err != nil {
+			return err
+		}
+		if err := tx.Preload("Author").Preload("Categories").Preload("Tags").First(&post, post.ID).Error; err != nil {
+			return err
+		}
+		recordRevision(tx, c, post)
+		if resubmit {
+			recordTransition(tx, c, post.ID, models.WorkflowResubmit, before.Status, post.Status, "")
+		}
+		return nil
+	})
+	if isSlugError(err) {
+		slugError(c, err)
+		return
+	}
+	if err != nil {
+		writeError(c, err, &models.Post{}, post.ID, "Restore failed")
+		return
+	}
+	recordAudit(database.DB, c, "restore_revision", "post", post.ID, before, post)
+	reindexPost(post.ID)
+	c.Header("ETag", helpers.ETag(post.ID, post.Version))
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Revision restored", Data: post})
+}
+
+// recordRevision snapshots post, which must have its Categories and Tags loaded.
+// Failures are logged rather than failing the request that saved the post.
+func recordRevision(tx *gorm.DB, c *gin.Context, post models.Post) {
+	revision := revisionOf(post)
+	if user, ok := c.Get("current_user"); ok {
+		id := user.(models.User).ID
+		revision.UserID = &id
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		logger.Errorf("revision of post %d failed: %v", post.ID, err)
+	}
+}
+
+// recordBaselineRevision snapshots a post that has no revisions yet, so its first tracked edit can be undone
+func recordBaselineRevision(tx *gorm.DB, post models.Post) {
+	var count int64
+	tx.Model(&models.PostRevision{}).Where("post_id = ?", post.ID).Count(&count)
+	if count > 0 {
+		return
+	}
+	revision := revisionOf(post)
+	revision.CreatedAt = post.UpdatedAt
+	if err := tx.Create(&revision).Error; err != nil {
+		logger.Errorf("baseline revision of post %d failed: %v", post.ID, err)
+	}
+}
+
+func revisionOf(post models.Post) models.PostRevision {
+	categoryIDs := make([]uint, len(post.Categories))
+	for i, cat := range post.Categories {
+		categoryIDs[i] = cat.ID
+	}
+	tagIDs := make([]uint, len(post.Tags))
+	for i, t := range post.Tags {
+		tagIDs[i] = t.ID
+	}
+	cats, _ := json.Marshal(categoryIDs)
+	tags, _ := json.Marshal(tagIDs)
+	return models.PostRevision{
+		PostID:        post.ID,
+		Title:         post.Title,
+		Slug:          post.Slug,
+		Content:       post.Content,
+		Excerpt:       post.Excerpt,
+		AuthorID:      post.AuthorID,
+		Status:        post.Status,
+		FeaturedImage: post.FeaturedImage,
+		CategoryIDs:   cats,
+		TagIDs:        tags,
+	}
+}
+
+// revisionFields is the JSON of a revision's post fields other than content, for JSONDiff
+func revisionFields(revision models.PostRevision) []byte {
+	revision.ID, revision.UserID, revision.Content, revision.CreatedAt = 0, nil, "", time.Time{}
+	b, _ := json.Marshal(revision)
+	return b
+}
+
+// findRevisablePost loads the post named by :id with its terms, writing a 400/403/404 response
+// if that fails or the current user may not edit it
+func findRevisablePost(c *gin.Context) (models.Post, bool) {
+	var post models.Post
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid post ID"})
+		return post, false
+	}
+	if err := database.DB.Preload("Categories").Preload("Tags").First(&post, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Post not found"})
+		return post, false
+	}
+	if !canTouchPost(c, post, models.AbilityPostsEditOthers) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You may only view the history of your own posts"})
+		return post, false
+	}
+	return post, true
+}
+
+// findRevision loads revision rawID of the post, writing a 400/404 response if that fails
+func findRevision(c *gin.Context, postID uint, rawID string) (models.PostRevision, bool) {
+	var revision models.PostRevision
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid revision ID"})
+		return revision, false
+	}
+	if err := database.DB.Where("post_id = ?", postID).First(&revision, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Revision not found"})
+		return revision, false
+	}
+	return revision, true
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/infra/logger"
+	"beres/infra/search"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxSearchResults = 1000
+	snippetWidth     = 160
+)
+
+// relevance of a post on MySQL; tag and category name matches weigh double. The placeholder in
+// the CASE is the condition under which the content of a password-protected post may be matched.
+const fullTextScore = `CASE WHEN COALESCE(posts.password_hash, '') = '' OR (%s)
+		THEN MATCH(posts.title, posts.excerpt, posts.content) AGAINST (?) ELSE MATCH(posts.title) AGAINST (?) END
+	+ 2 * (SELECT COALESCE(SUM(MATCH(tags.name) AGAINST (?)), 0) FROM posts_tags
+		JOIN tags ON tags.id = posts_tags.tag_id AND tags.deleted_at IS NULL WHERE posts_tags.post_id = posts.id)
+	+ 2 * (SELECT COALESCE(SUM(MATCH(categories.name) AGAINST (?)), 0) FROM posts_categories
+		JOIN categories ON categories.id = posts_categories.category_id AND categories.deleted_at IS NULL WHERE posts_categories.post_id = posts.id)`
+
+type searchResult struct {
+	Post       models.Post       `json:"post"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+var (
+	fullTextOnce      sync.Once
+	fullTextAvailable bool
+
+	// postIndex serves search when the FULLTEXT indexes are missing; it is filled on first use
+	postIndex       = search.NewIndex()
+	postIndexMu     sync.Mutex
+	postIndexLoaded bool
+)
+
+// SearchPosts ranks the posts the caller may see matching ?q in their title, excerpt, content, tags or categories
+func SearchPosts(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	terms := search.Tokenize(q)
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Search query must contain a word"})
+		return
+	}
+	page, err := helpers.Page(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	perPage, err := helpers.PerPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+
+	scope := database.DB.Model(&models.Post{}).Scopes(visiblePosts(c))
+	hits, err := rankPosts(c, scope, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Search failed", Data: err.Error()})
+		return
+	}
+
+	from := min((page-1)*perPage, len(hits))
+	to := min(from+perPage, len(hits))
+	ids := make([]uint, 0, to-from)
+	for _, h := range hits[from:to] {
+		ids = append(ids, h.ID)
+	}
+	var posts []models.Post
+	if len(ids) > 0 {
+		if err := database.DB.Scopes(readablePosts(c)).Preload("Author").Preload("Categories").Preload("Tags").Find(&posts, ids).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Search failed", Data: err.Error()})
+			return
+		}
+	}
+	byID := make(map[uint]models.Post, len(posts))
+	for _, p := range posts {
+		byID[p.ID] = p
+	}
+
+	results := make([]searchResult, 0, len(ids))
+	for _, h := range hits[from:to] {
+		post, ok := byID[h.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, searchResult{Post: post, Score: h.Score, Highlights: postHighlights(post, terms)})
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Search results", Data: results, Meta: helpers.PageMeta(c, page, perPage, int64(len(hits)))})
+}
+
+// postHighlights returns the marked-up snippets of the post's fields that contain a term
+func postHighlights(post models.Post, terms []string) map[string]string {
+	highlights := map[string]string{}
+	for field, text := range map[string]string{"title": post.Title, "excerpt": post.Excerpt, "content": post.Content} {
+		width := snippetWidth
+		if field == "title" {
+			width = len(text)
+		}
+		if snippet := helpers.Highlight(text, terms, width); snippet != "" {
+			highlights[field] = snippet
+		}
+	}
+	return highlights
+}
+
+// rankPosts returns up to maxSearchResults posts within scope that match q, best first. The content
+// of password-protected posts only counts when the caller may read it.
+func rankPosts(c *gin.Context, scope *gorm.DB, q string) ([]search.Hit, error) {
+	readable, readableArgs := protectedReadable(c)
+	if usesFullText() {
+		args := append(readableArgs, q, q, q, q)
+		var hits []search.Hit
+		err := scope.Session(&gorm.Session{}).
+			Select("posts.id AS id, ("+fmt.Sprintf(fullTextScore, readable)+") AS score", args...).
+			Having("score > 0").
+			Order("score DESC, posts.id DESC").
+			Limit(maxSearchResults).
+			Scan(&hits).Error
+		return hits, err
+	}
+
+	ix, err := loadedPostIndex()
+	if err != nil {
+		return nil, err
+	}
+	var hidden []uint
+	err = scope.Session(&gorm.Session{}).
+		Where("COALESCE(posts.password_hash, '') <> ''").
+		Where("NOT ("+readable+")", readableArgs...).
+		Pluck("posts.id", &hidden).Error
+	if err != nil {
+		return nil, err
+	}
+	unreadable := make(map[uint]bool, len(hidden))
+	for _, id := range hidden {
+		unreadable[id] = true
+	}
+
+	// the index holds every post; keep the hits the scope allows, in rank order
+	const batchSize = 500
+	all := ix.Search(q, func(id uint) bool { return !unreadable[id] })
+	var hits []search.Hit
+	for start := 0; start < len(all) && len(hits) < maxSearchResults; start += batchSize {
+		batch := all[start:min(start+batchSize, len(all))]
+		ids := make([]uint, len(batch))
+		for i, h := range batch {
+			ids[i] = h.ID
+		}
+		var allowed []uint
+		if err := scope.Session(&gorm.Session{}).Where("posts.id IN ?", ids).Pluck("posts.id", &allowed).Error; err != nil {
+			return nil, err
+		}
+		ok := make(map[uint]bool, len(allowed))
+		for _, id := range allowed {
+			ok[id] = true
+		}
+		for _, h := range batch {
+			if ok[h.ID] {
+				hits = append(hits, h)
+			}
+		}
+	}
+	if len(hits) > maxSearchResults {
+		hits = hits[:maxSearchResults]
+	}
+	return hits, nil
+}
+
+// usesFullText reports whether the migration managed to create every FULLTEXT search index
+func usesFullText() bool {
+	fullTextOnce.Do(func() {
+		if database.DB.Dialector.Name() != "mysql" {
+			return
+		}
+		migrator := database.DB.Migrator()
+		for _, idx := range models.SearchIndexes {
+			if !migrator.HasIndex(idx.Model, idx.Name) {
+				logger.Infof("search index %s is missing, searching posts in memory", idx.Name)
+				return
+			}
+		}
+		fullTextAvailable = true
+	})
+	return fullTextAvailable
+}
+
+// loadedPostIndex returns postIndex, indexing every post the first time it is called
+func loadedPostIndex() (*search.Index, error) {
+	postIndexMu.Lock()
+	defer postIndexMu.Unlock()
+	if postIndexLoaded {
+		return postIndex, nil
+	}
+	var posts []models.Post
+	err := database.DB.Preload("Categories").Preload("Tags").FindInBatches(&posts, 500, func(tx *gorm.DB, batch int) error {
+		for _, p := range posts {
+			postIndex.Put(p.ID, postSearchFields(p)...)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	postIndexLoaded = true
+	return postIndex, nil
+}
+
+// postSearchFields are the indexed fields of post; the excerpt and content of a password-protected
+// post only count for callers who may read them
+func postSearchFields(post models.Post) []search.Field {
+	fields := []search.Field{
+		{Text: post.Title, Weight: 3},
+		{Text: post.Excerpt, Weight: 2, Restricted: post.PasswordProtected},
+		{Text: helpers.StripTags(post.Content), Weight: 1, Restricted: post.PasswordProtected},
+	}
+	for _, t := range post.Tags {
+		fields = append(fields, search.Field{Text: t.Name, Weight: 2})
+	}
+	for _, cat := range post.Categories {
+		fields = append(fields, search.Field{Text: cat.Name, Weight: 2})
+	}
+	return fields
+}
+
+// reindexPost refreshes the in-memory index after a post was written; FULLTEXT indexes keep themselves current
+func reindexPost(id uint) {
+	if usesFullText() {
+		return
+	}
+	ix, err := loadedPostIndex()
+	if err != nil {
+		logger.Errorf("loading the search index failed: %v", err)
+		return
+	}
+	var post models.Post
+	if err := database.DB.Preload("Categories").Preload("Tags").First(&post, id).Error; err != nil {
+		ix.Remove(id)
+		return
+	}
+	ix.Put(post.ID, postSearchFields(post)...)
+}
+
+// reindexPostsOf reindexes the posts linked through joinTable to a renamed or deleted tag or category
+func reindexPostsOf(joinTable, column string, termID uint) {
+	if usesFullText() {
+		return
+	}
+	var ids []uint
+	database.DB.Table(joinTable).Where(column+" = ?", termID).Pluck("post_id", &ids)
+	for _, id := range ids {
+		reindexPost(id)
+	}
+}
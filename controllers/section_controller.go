@@ -12,14 +12,25 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// GetSectionData returns all sections
+var sectionListOptions = helpers.ListOptions{
+	Sortable: map[string]string{"display_order": "display_order", "name": "name", "created_at": "created_at"},
+	Filters: map[string]helpers.Filter{
+		"section_type": helpers.Equals("section_type"),
+		"is_active":    helpers.Bool("is_active"),
+	},
+	DefaultSort: "display_order",
+}
+
+// GetSectionData lists sections, one page at a time
 func GetSectionData(ctx *gin.Context) {
 	var sections []models.Section
-	if err := repository.Get(&sections); err != nil {
-		ctx.JSON(http.StatusInternalServerError, helpers.Response{
-			Code:    http.StatusInternalServerError,
+	meta, err := helpers.Paginate(ctx, database.DB, sectionListOptions, &sections)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		ctx.JSON(code, helpers.Response{
+			Code:    code,
 			Message: "Failed to fetch sections",
-			Data:    err,
+			Data:    err.Error(),
 		})
 		return
 	}
@@ -27,6 +38,7 @@ func GetSectionData(ctx *gin.Context) {
 		Code:    http.StatusOK,
 		Message: "Sections retrieved",
 		Data:    sections,
+		Meta:    meta,
 	})
 }
 
@@ -50,6 +62,9 @@ func GetSectionByID(ctx *gin.Context) {
 		})
 		return
 	}
+	if notModified(ctx, section.ID, section.Version) {
+		return
+	}
 	ctx.JSON(http.StatusOK, helpers.Response{
 		Code:    http.StatusOK,
 		Message: "Section retrieved",
@@ -77,6 +92,7 @@ func CreateSection(ctx *gin.Context) {
 		})
 		return
 	}
+	recordAudit(database.DB, ctx, models.AuditCreate, "section", section.ID, nil, section)
 	ctx.JSON(http.StatusCreated, helpers.Response{
 		Code:    http.StatusCreated,
 		Message: "Section created",
@@ -84,7 +100,7 @@ func CreateSection(ctx *gin.Context) {
 	})
 }
 
-// UpdateSection updates an existing section by ID
+// UpdateSection updates an existing section from a full body (PUT) or a merge patch (PATCH)
 func UpdateSection(ctx *gin.Context) {
 	idParam := ctx.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 64)
@@ -96,16 +112,6 @@ func UpdateSection(ctx *gin.Context) {
 		return
 	}
 
-	var input models.Section
-	if err := ctx.ShouldBindJSON(&input); err != nil {
-		ctx.JSON(http.StatusBadRequest, helpers.Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid request payload",
-			Data:    err.Error(),
-		})
-		return
-	}
-
 	var section models.Section
 	if err := database.DB.First(&section, id).Error; err != nil {
 		ctx.JSON(http.StatusNotFound, helpers.Response{
@@ -115,21 +121,43 @@ func UpdateSection(ctx *gin.Context) {
 		return
 	}
 
+	if !ifMatch(ctx, section.ID, section.Version) {
+		return
+	}
+
+	input := section
+	if err := helpers.BindUpdate(ctx, &input); err != nil {
+		ctx.JSON(http.StatusBadRequest, helpers.Response{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request payload",
+			Data:    err.Error(),
+		})
+		return
+	}
+
 	// Update fields
+	before := section
 	section.Name = input.Name
 	section.SectionType = input.SectionType
 	section.DisplayOrder = input.DisplayOrder
 	section.IsActive = input.IsActive
 	section.Details = input.Details
-
-	if err := database.DB.Save(&section).Error; err != nil {
-		ctx.JSON(http.StatusInternalServerError, helpers.Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to update section",
-			Data:    err,
-		})
+	section.Version = before.Version + 1
+
+	err = versioned(database.DB.Model(&section).Where("version = ?", before.Version).Updates(map[string]interface{}{
+		"Name":         section.Name,
+		"SectionType":  section.SectionType,
+		"DisplayOrder": section.DisplayOrder,
+		"IsActive":     section.IsActive,
+		"Details":      section.Details,
+		"Version":      section.Version,
+	}))
+	if err != nil {
+		writeError(ctx, err, &models.Section{}, section.ID, "Failed to update section")
 		return
 	}
+	recordAudit(database.DB, ctx, models.AuditUpdate, "section", section.ID, before, section)
+	ctx.Header("ETag", helpers.ETag(section.ID, section.Version))
 	ctx.JSON(http.StatusOK, helpers.Response{
 		Code:    http.StatusOK,
 		Message: "Section updated",
@@ -158,14 +186,14 @@ func DeleteSection(ctx *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&section).Error; err != nil {
-		ctx.JSON(http.StatusInternalServerError, helpers.Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to delete section",
-			Data:    err,
-		})
+	if !ifMatch(ctx, section.ID, section.Version) {
+		return
+	}
+	if err := versioned(database.DB.Where("version = ?", section.Version).Delete(&section)); err != nil {
+		writeError(ctx, err, &models.Section{}, section.ID, "Failed to delete section")
 		return
 	}
+	recordAudit(database.DB, ctx, models.AuditDelete, "section", section.ID, section, nil)
 	ctx.JSON(http.StatusOK, helpers.Response{
 		Code:    http.StatusOK,
 		Message: "Section deleted",
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/infra/throttle"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// session is what a successful login or refresh returns
+type session struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	IdleTimeout      int       `json:"idle_timeout"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// completeLogin starts a session for an authenticated user and writes the login response
+func completeLogin(c *gin.Context, user models.User, tokenName string) {
+	throttle.LoginEmail.Reset(loginEmailKey(user.Email))
+	_, _, refreshLifetime := sessionLifetimes()
+	refreshExpiresAt := time.Now().Add(refreshLifetime)
+	var s session
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		s, err = issueSession(tx, user.ID, tokenName, helpers.GenerateRandomString(32), refreshExpiresAt)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Token creation failed", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Login successful", Data: s})
+}
+
+// RefreshSession rotates a refresh token: the old one and its access token are retired and a new
+// pair is issued in the same family. Presenting a refresh token twice revokes the whole family.
+func RefreshSession(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	var old models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", helpers.HashToken(input.RefreshToken)).First(&old).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid refresh token"})
+		return
+	}
+	if old.RevokedAt == nil && !old.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Refresh token expired"})
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, old.UserID).Error; err != nil || !user.Active() {
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid refresh token"})
+		return
+	}
+
+	var s session
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if old.UsedAt != nil || old.RevokedAt != nil {
+			return errRefreshTokenReused
+		}
+		// the used_at guard lets only one of two concurrent refreshes win
+		res := tx.Model(&old).Where("used_at IS NULL").Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+		var previous models.PersonalAccessToken
+		tx.Where("family_id = ?", old.FamilyID).Order("id DESC").Limit(1).Find(&previous)
+		if err := tx.Where("family_id = ?", old.FamilyID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		var err error
+		s, err = issueSession(tx, old.UserID, previous.Name, old.FamilyID, old.ExpiresAt)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		revokeTokenFamily(database.DB, old.FamilyID)
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Refresh token reuse detected, session revoked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Token refresh failed", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Token refreshed", Data: s})
+}
+
+// issueSession stores an access token and a refresh token belonging to familyID
+func issueSession(tx *gorm.DB, userID uint, name, familyID string, refreshExpiresAt time.Time) (session, error) {
+	lifetime, idle, _ := sessionLifetimes()
+	token := models.PersonalAccessToken{
+		UserID:      userID,
+		Name:        name,
+		Abilities:   models.AbilityAll,
+		ExpiresAt:   ptrTime(time.Now().Add(lifetime)),
+		IdleTimeout: int(idle.Seconds()),
+		FamilyID:    familyID,
+	}
+	raw, err := issueToken(tx, &token)
+	if err != nil {
+		return session{}, err
+	}
+	rawRefresh := helpers.GenerateRandomString(48)
+	refresh := models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: helpers.HashToken(rawRefresh),
+		ExpiresAt: refreshExpiresAt,
+	}
+	if err := tx.Create(&refresh).Error; err != nil {
+		return session{}, err
+	}
+	return session{
+		Token:            raw,
+		ExpiresAt:        *token.ExpiresAt,
+		IdleTimeout:      token.IdleTimeout,
+		RefreshToken:     rawRefresh,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, nil
+}
+
+// sessionLifetimes returns the configured access token lifetime, idle timeout and refresh token lifetime
+func sessionLifetimes() (lifetime, idle, refresh time.Duration) {
+	viper.SetDefault("TOKEN_LIFETIME_MINUTES", 24*60)
+	viper.SetDefault("TOKEN_IDLE_TIMEOUT_MINUTES", 120)
+	viper.SetDefault("REFRESH_TOKEN_LIFETIME_HOURS", 30*24)
+	return time.Duration(viper.GetInt("TOKEN_LIFETIME_MINUTES")) * time.Minute,
+		time.Duration(viper.GetInt("TOKEN_IDLE_TIMEOUT_MINUTES")) * time.Minute,
+		time.Duration(viper.GetInt("REFRESH_TOKEN_LIFETIME_HOURS")) * time.Hour
+}
+
+// revokeTokenFamily ends a login session: its refresh tokens are revoked and access tokens deleted
+func revokeTokenFamily(tx *gorm.DB, familyID string) error {
+	if err := tx.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return tx.Where("family_id = ?", familyID).Delete(&models.PersonalAccessToken{}).Error
+}
+
+// revokeUserSessions deletes every access token of the user and revokes all refresh tokens
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.PersonalAccessToken{}).Error
+}
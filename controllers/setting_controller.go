@@ -17,14 +17,22 @@ type settingInput struct {
 	Value string `json:"value" binding:"required"`
 }
 
-// GetSettings returns all settings
+var settingListOptions = helpers.ListOptions{
+	Sortable:    map[string]string{"key": "`key`", "created_at": "created_at", "updated_at": "updated_at"},
+	Filters:     map[string]helpers.Filter{"key": helpers.Equals("`key`")},
+	DefaultSort: "key",
+}
+
+// GetSettings lists settings, one page at a time
 func GetSettings(c *gin.Context) {
 	var settings []models.Setting
-	if err := database.DB.Find(&settings).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch settings", Data: err.Error()})
+	meta, err := helpers.Paginate(c, database.DB, settingListOptions, &settings)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch settings", Data: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Settings retrieved", Data: settings})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Settings retrieved", Data: settings, Meta: meta})
 }
 
 // GetSettingByID returns a setting by its ID
@@ -39,6 +47,9 @@ func GetSettingByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Setting not found"})
 		return
 	}
+	if notModified(c, setting.ID, setting.Version) {
+		return
+	}
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Setting retrieved", Data: setting})
 }
 
@@ -54,27 +65,40 @@ func CreateSetting(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to create setting", Data: err.Error()})
 		return
 	}
+	recordAudit(database.DB, c, models.AuditCreate, "setting", setting.ID, nil, setting)
 	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "Setting created", Data: setting})
 }
 
-// UpdateSetting updates an existing setting by ID
+// UpdateSetting updates an existing setting from a full body (PUT) or a merge patch (PATCH)
 func UpdateSetting(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid setting ID"})
 		return
 	}
-	var input settingInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
-		return
-	}
 	var setting models.Setting
 	if err := database.DB.First(&setting, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Setting not found"})
 		return
 	}
-	database.DB.Model(&setting).Updates(models.Setting{Key: input.Key, Value: input.Value})
+	if !ifMatch(c, setting.ID, setting.Version) {
+		return
+	}
+	input := settingInput{Key: setting.Key, Value: setting.Value}
+	if err := helpers.BindUpdate(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := setting
+	err = versioned(database.DB.Model(&setting).Where("version = ?", before.Version).
+		Select("Key", "Value", "Version").
+		Updates(models.Setting{Versioned: models.Versioned{Version: before.Version + 1}, Key: input.Key, Value: input.Value}))
+	if err != nil {
+		writeError(c, err, &models.Setting{}, setting.ID, "Failed to update setting")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditUpdate, "setting", setting.ID, before, setting)
+	c.Header("ETag", helpers.ETag(setting.ID, setting.Version))
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Setting updated", Data: setting})
 }
 
@@ -85,9 +109,18 @@ func DeleteSetting(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid setting ID"})
 		return
 	}
-	if err := database.DB.Delete(&models.Setting{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to delete setting", Data: err.Error()})
+	var setting models.Setting
+	if err := database.DB.First(&setting, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Setting not found"})
+		return
+	}
+	if !ifMatch(c, setting.ID, setting.Version) {
+		return
+	}
+	if err := versioned(database.DB.Where("version = ?", setting.Version).Delete(&setting)); err != nil {
+		writeError(c, err, &models.Setting{}, setting.ID, "Failed to delete setting")
 		return
 	}
+	recordAudit(database.DB, c, models.AuditDelete, "setting", setting.ID, setting, nil)
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Setting deleted"})
 }
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errSlugTaken   = errors.New("slug is already in use")
+	errInvalidSlug = errors.New("slug must contain a letter or digit")
+)
+
+// sluggable describes a model whose rows are addressed by a unique slug
+type sluggable struct {
+	model  interface{}
+	entity string // entity type of its slug redirects
+	maxLen int    // size of its slug column
+}
+
+var (
+	postSlugs     = sluggable{model: &models.Post{}, entity: "post", maxLen: 255}
+	categorySlugs = sluggable{model: &models.Category{}, entity: "category", maxLen: 50}
+	tagSlugs      = sluggable{model: &models.Tag{}, entity: "tag", maxLen: 50}
+)
+
+// choose picks the slug of row id (0 for a new row), whose slug is now current ("" for a new row).
+// A requested slug is normalised and must be free; without one the current slug is kept or, for a
+// new row, a free slug is generated from title.
+func (s sluggable) choose(tx *gorm.DB, requested, current, title string, id uint) (string, error) {
+	// sending the current slug back, as a merge patch base does, keeps it even if it predates normalisation
+	if requested == current && current != "" {
+		return current, nil
+	}
+	if requested == "" {
+		if current != "" {
+			return current, nil
+		}
+		slug := helpers.Slugify(title, s.maxLen)
+		if slug == "" {
+			slug = s.entity
+		}
+		return helpers.UniqueSlug(tx, s.model, slug, id, s.maxLen)
+	}
+	slug := helpers.Slugify(requested, s.maxLen)
+	if slug == "" {
+		return "", errInvalidSlug
+	}
+	if slug == current {
+		return slug, nil
+	}
+	var count int64
+	if err := tx.Unscoped().Model(s.model).Where("slug = ? AND id <> ?", slug, id).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", errSlugTaken
+	}
+	return slug, nil
+}
+
+// claim records that row id moved from oldSlug to newSlug: oldSlug now redirects to the row, and
+// newSlug stops redirecting to whichever row used to have it
+func (s sluggable) claim(tx *gorm.DB, id uint, oldSlug, newSlug string) error {
+	err := tx.Where("entity_type = ? AND old_slug IN ?", s.entity, []string{oldSlug, newSlug}).
+		Delete(&models.SlugRedirect{}).Error
+	if err != nil || oldSlug == "" || oldSlug == newSlug {
+		return err
+	}
+	return tx.Create(&models.SlugRedirect{EntityType: s.entity, OldSlug: oldSlug, EntityID: id}).Error
+}
+
+// redirect answers 301 with the current slug if the slug in route parameter param is a former
+// slug of a row within scope. It reports whether it did.
+func (s sluggable) redirect(c *gin.Context, scope *gorm.DB, param string) bool {
+	old := c.Param(param)
+	var redirect models.SlugRedirect
+	if err := database.DB.Where("entity_type = ? AND old_slug = ?", s.entity, old).First(&redirect).Error; err != nil {
+		return false
+	}
+	var slugs []string
+	scope.Session(&gorm.Session{}).Model(s.model).Where("id = ?", redirect.EntityID).Limit(1).Pluck("slug", &slugs)
+	if len(slugs) == 0 || slugs[0] == old {
+		return false
+	}
+
+	// swap the parameter's segment of the request path for the new slug
+	route := strings.Split(c.FullPath(), "/")
+	path := strings.Split(c.Request.URL.Path, "/")
+	for i := range route {
+		if route[i] == ":"+param && i < len(path) {
+			path[i] = url.PathEscape(slugs[0])
+		}
+	}
+	location := strings.Join(path, "/")
+	if c.Request.URL.RawQuery != "" {
+		location += "?" + c.Request.URL.RawQuery
+	}
+	c.Header("Location", location)
+	c.JSON(http.StatusMovedPermanently, helpers.Response{Code: http.StatusMovedPermanently, Message: "Moved permanently", Data: gin.H{"slug": slugs[0]}})
+	return true
+}
+
+// isSlugError reports whether err is a slug problem for slugError to answer. A duplicate key means
+// a concurrent write took the slug between choose and the insert.
+func isSlugError(err error) bool {
+	return errors.Is(err, errSlugTaken) || errors.Is(err, errInvalidSlug) || errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// slugError responds to an error from choose or claim
+func slugError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errSlugTaken), errors.Is(err, gorm.ErrDuplicatedKey):
+		c.JSON(http.StatusConflict, helpers.Response{Code: http.StatusConflict, Message: "Slug is already in use"})
+	case errors.Is(err, errInvalidSlug):
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Slug must contain a letter or digit"})
+	default:
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to save slug", Data: err.Error()})
+	}
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/cache"
+	"beres/infra/database"
+	"beres/infra/search"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// how a tag suggestion matched the query, best first
+const (
+	matchPrefix = iota
+	matchWord
+	matchContains
+	matchFuzzy
+)
+
+var matchNames = []string{"prefix", "word", "contains", "fuzzy"}
+
+type tagSuggestion struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Match string `json:"match"`
+	rank  int
+	typos int
+}
+
+type tagCloudEntry struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	PostCount int    `json:"post_count"`
+	Weight    int    `json:"weight"`
+}
+
+// TagAutocomplete suggests tags for ?q: names or slugs starting with it first, then names with a
+// word starting with it, names containing it, and finally names within a typo or two of it
+func TagAutocomplete(c *gin.Context) {
+	q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "q is required"})
+		return
+	}
+	limit, err := helpers.IntQuery(c, "limit", 10, 1, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	tags, err := cachedTags()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch tags", Data: err.Error()})
+		return
+	}
+
+	qLen := len([]rune(q))
+	maxTypos := search.MaxTypos(qLen)
+	suggestions := []tagSuggestion{}
+	for _, tag := range tags {
+		s := tagSuggestion{ID: tag.ID, Name: tag.Name, Slug: tag.Slug}
+		name := strings.ToLower(tag.Name)
+		switch {
+		case strings.HasPrefix(name, q) || strings.HasPrefix(tag.Slug, q):
+			s.rank = matchPrefix
+		case hasWordPrefix(name, q):
+			s.rank = matchWord
+		case strings.Contains(name, q):
+			s.rank = matchContains
+		default:
+			// compare with the start of the name too, so a misspelt prefix still matches
+			head := []rune(name)
+			if len(head) > qLen {
+				head = head[:qLen]
+			}
+			s.typos = min(search.Distance(q, name), search.Distance(q, string(head)))
+			if maxTypos == 0 || s.typos > maxTypos {
+				continue
+			}
+			s.rank = matchFuzzy
+		}
+		s.Match = matchNames[s.rank]
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.typos != b.typos {
+			return a.typos < b.typos
+		}
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) < len(b.Name)
+		}
+		return a.Name < b.Name
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tags suggested", Data: suggestions})
+}
+
+func hasWordPrefix(name, q string) bool {
+	for _, word := range search.Tokenize(name) {
+		if strings.HasPrefix(word, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedTags returns the ID, name and slug of every tag
+func cachedTags() ([]models.Tag, error) {
+	if tags, ok := cache.Tags.Get("all"); ok {
+		return tags.([]models.Tag), nil
+	}
+	var tags []models.Tag
+	if err := database.DB.Select("id", "name", "slug").Order("name").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	cache.Tags.Set("all", tags)
+	return tags, nil
+}
+
+// GetTagCloud returns the ?limit tags used by the most published posts, ordered by name, each
+// with its post count and a weight from 1 to ?weights for sizing it in a cloud
+func GetTagCloud(c *gin.Context) {
+	limit, err := helpers.IntQuery(c, "limit", 50, 1, 200)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	weights, err := helpers.IntQuery(c, "weights", 5, 2, 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	key := fmt.Sprintf("cloud:%d:%d", limit, weights)
+	if cloud, ok := cache.Tags.Get(key); ok {
+		c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tag cloud retrieved", Data: cloud})
+		return
+	}
+
+	now := time.Now()
+	cloud := []tagCloudEntry{}
+	err = database.DB.Model(&models.Tag{}).
+		Select("tags.id, tags.name, tags.slug, COUNT(*) AS post_count").
+		Joins("JOIN posts_tags ON posts_tags.tag_id = tags.id").
+		Joins("JOIN posts ON posts.id = posts_tags.post_id AND posts.deleted_at IS NULL").
+		Where(livePost, models.PostStatusPublish, now, now).
+		Group("tags.id, tags.name, tags.slug").
+		Order("post_count DESC, tags.name").
+		Limit(limit).
+		Scan(&cloud).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to build tag cloud", Data: err.Error()})
+		return
+	}
+	weighTags(cloud, weights)
+	sort.Slice(cloud, func(i, j int) bool { return cloud[i].Name < cloud[j].Name })
+	cache.Tags.Set(key, cloud)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tag cloud retrieved", Data: cloud})
+}
+
+// weighTags buckets post counts into weights 1 to classes on a logarithmic scale, so that a few
+// very popular tags do not squash all others into the lowest weight. Equal counts get the middle weight.
+func weighTags(cloud []tagCloudEntry, classes int) {
+	if len(cloud) == 0 {
+		return
+	}
+	lo, hi := cloud[0].PostCount, cloud[0].PostCount
+	for _, t := range cloud {
+		lo, hi = min(lo, t.PostCount), max(hi, t.PostCount)
+	}
+	span := math.Log(float64(hi)) - math.Log(float64(lo))
+	for i := range cloud {
+		if span == 0 {
+			cloud[i].Weight = (classes + 1) / 2
+			continue
+		}
+		share := (math.Log(float64(cloud[i].PostCount)) - math.Log(float64(lo))) / span
+		cloud[i].Weight = 1 + int(math.Round(share*float64(classes-1)))
+	}
+}
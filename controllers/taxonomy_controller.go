@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/models"
+	"beres/routers/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// taxonomy is a kind of term that posts are filed under
+type taxonomy struct {
+	slugs     sluggable
+	trash     string // key of its models.Trashables entry
+	joinTable string // links posts to its terms
+	column    string // term column of joinTable
+}
+
+var (
+	categoryTaxonomy = taxonomy{slugs: categorySlugs, trash: "categories", joinTable: "posts_categories", column: "category_id"}
+	tagTaxonomy      = taxonomy{slugs: tagSlugs, trash: "tags", joinTable: "posts_tags", column: "tag_id"}
+)
+
+type mergeInput struct {
+	TargetID uint `json:"target_id" binding:"required"`
+}
+
+type bulkTagInput struct {
+	Action string `json:"action" binding:"required,oneof=add remove"`
+	// Filter selects posts with the filters of GET /posts, e.g. {"category": "go", "status": "draft"}
+	Filter map[string]string `json:"filter" binding:"required"`
+}
+
+// MergeTags files the posts of tag :id under tag target_id and deletes tag :id for good;
+// its slug then redirects to the target
+func MergeTags(c *gin.Context) {
+	var source, target models.Tag
+	if !findMergePair(c, &source, &target, "Tag") {
+		return
+	}
+	if !ifMatch(c, source.ID, source.Version) {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tagTaxonomy.merge(tx, source.ID, source.Slug, target.ID, target.Slug); err != nil {
+			return err
+		}
+		recordAudit(tx, c, "merge", "tag", source.ID, source, target)
+		return nil
+	})
+	if err != nil {
+		writeError(c, err, &models.Tag{}, source.ID, "Merge failed")
+		return
+	}
+	reindexPostsOf(tagTaxonomy.joinTable, tagTaxonomy.column, target.ID)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tags merged", Data: target})
+}
+
+// MergeCategories files the posts of category :id under category target_id, moves its children
+// under the target and deletes category :id for good; its slug then redirects to the target
+func MergeCategories(c *gin.Context) {
+	var source, target models.Category
+	if !findMergePair(c, &source, &target, "Category") {
+		return
+	}
+	if !ifMatch(c, source.ID, source.Version) {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// the children move under the target, so it must not be one of them
+		if err := checkCategoryParent(tx, source.ID, &target.ID); err != nil {
+			return err
+		}
+		children := map[string]interface{}{"parent_id": target.ID, "version": gorm.Expr("version + 1")}
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", source.ID).Updates(children).Error; err != nil {
+			return err
+		}
+		if err := categoryTaxonomy.merge(tx, source.ID, source.Slug, target.ID, target.Slug); err != nil {
+			return err
+		}
+		recordAudit(tx, c, "merge", "category", source.ID, source, target)
+		return nil
+	})
+	if errors.Is(err, errCategoryCycle) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "A category cannot be merged into one of its descendants"})
+		return
+	}
+	if err != nil {
+		writeError(c, err, &models.Category{}, source.ID, "Merge failed")
+		return
+	}
+	reindexPostsOf(categoryTaxonomy.joinTable, categoryTaxonomy.column, target.ID)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Categories merged", Data: target})
+}
+
+// findMergePair loads term :id into source and the target_id of the body into target, writing
+// a 400/404/422 response if that fails
+func findMergePair(c *gin.Context, source, target interface{}, noun string) bool {
+	entity := strings.ToLower(noun)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid " + entity + " ID"})
+		return false
+	}
+	var input mergeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return false
+	}
+	if uint(id) == input.TargetID {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Cannot merge a " + entity + " into itself"})
+		return false
+	}
+	if err := database.DB.First(source, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: noun + " not found"})
+		return false
+	}
+	if err := database.DB.First(target, input.TargetID).Error; err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Target " + entity + " does not exist"})
+		return false
+	}
+	return true
+}
+
+// merge moves the post links of term source to term target and deletes source for good.
+// Former slugs of source, and its own slug, redirect to target from then on.
+func (t taxonomy) merge(tx *gorm.DB, source uint, sourceSlug string, target uint, targetSlug string) error {
+	var postIDs []uint
+	if err := tx.Table(t.joinTable).Where(t.column+" = ?", source).Pluck("post_id", &postIDs).Error; err != nil {
+		return err
+	}
+	if _, err := t.link(tx, target, postIDs); err != nil {
+		return err
+	}
+	err := tx.Model(&models.SlugRedirect{}).
+		Where("entity_type = ? AND entity_id = ?", t.slugs.entity, source).
+		Update("entity_id", target).Error
+	if err != nil {
+		return err
+	}
+	// purging only takes rows from the trash, and removes the remaining links of source
+	trashable := models.Trashables[t.trash]
+	if err := tx.Delete(trashable.NewRow(), source).Error; err != nil {
+		return err
+	}
+	if err := trashable.Purge(tx, []uint{source}); err != nil {
+		return err
+	}
+	if err := t.slugs.claim(tx, target, sourceSlug, targetSlug); err != nil {
+		return err
+	}
+	return touchPosts(tx, postIDs)
+}
+
+// link files the posts postIDs under term, returning those that were not yet
+func (t taxonomy) link(tx *gorm.DB, term uint, postIDs []uint) ([]uint, error) {
+	linked, err := t.linked(tx, term, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	missing := missingIDs(postIDs, linked)
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	rows := make([]map[string]interface{}, len(missing))
+	for i, id := range missing {
+		rows[i] = map[string]interface{}{"post_id": id, t.column: term}
+	}
+	return missing, tx.Table(t.joinTable).CreateInBatches(rows, 500).Error
+}
+
+// unlink removes the posts postIDs from term, returning those that were filed under it
+func (t taxonomy) unlink(tx *gorm.DB, term uint, postIDs []uint) ([]uint, error) {
+	linked, err := t.linked(tx, term, postIDs)
+	if err != nil || len(linked) == 0 {
+		return nil, err
+	}
+	err = tx.Table(t.joinTable).Where(t.column+" = ? AND post_id IN ?", term, linked).Delete(map[string]interface{}{}).Error
+	return linked, err
+}
+
+// linked returns the posts among postIDs that are filed under term
+func (t taxonomy) linked(tx *gorm.DB, term uint, postIDs []uint) ([]uint, error) {
+	var linked []uint
+	if len(postIDs) == 0 {
+		return linked, nil
+	}
+	err := tx.Table(t.joinTable).Where(t.column+" = ? AND post_id IN ?", term, postIDs).Pluck("post_id", &linked).Error
+	return linked, err
+}
+
+// touchPosts moves the version of posts whose terms changed outside UpdatePost
+func touchPosts(tx *gorm.DB, postIDs []uint) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&models.Post{}).Where("id IN ?", postIDs).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// touchLinked moves the version of the posts filed under term, as their representations include it
+func (t taxonomy) touchLinked(tx *gorm.DB, term uint) error {
+	var postIDs []uint
+	if err := tx.Table(t.joinTable).Where(t.column+" = ?", term).Pluck("post_id", &postIDs).Error; err != nil {
+		return err
+	}
+	return touchPosts(tx, postIDs)
+}
+
+// BulkTagPosts adds tag :id to, or removes it from, every post matching the filter that the
+// current user may edit
+func BulkTagPosts(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid tag ID"})
+		return
+	}
+	var input bulkTagInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	var tag models.Tag
+	if err := database.DB.First(&tag, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Tag not found"})
+		return
+	}
+	// an empty filter would match every post, which is more likely a mistake than the intent
+	if len(input.Filter) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "filter must name at least one of: " + strings.Join(postFilterNames(), ", ")})
+		return
+	}
+	db := database.DB.Model(&models.Post{})
+	for name, value := range input.Filter {
+		filter, ok := postListOptions.Filters[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Unknown filter " + name + "; use one of: " + strings.Join(postFilterNames(), ", ")})
+			return
+		}
+		if db, err = filter(db, value); err != nil {
+			code := helpers.QueryErrorStatus(err)
+			c.JSON(code, helpers.Response{Code: code, Message: "Invalid filter", Data: err.Error()})
+			return
+		}
+	}
+	if !middleware.Can(c, models.AbilityPostsEditOthers) {
+		db = db.Where("posts.author_id = ?", currentUser(c).ID)
+	}
+	var postIDs []uint
+	if err := db.Pluck("posts.id", &postIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to find posts", Data: err.Error()})
+		return
+	}
+
+	var changed []uint
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if input.Action == "add" {
+			changed, err = tagTaxonomy.link(tx, tag.ID, postIDs)
+		} else {
+			changed, err = tagTaxonomy.unlink(tx, tag.ID, postIDs)
+		}
+		if err != nil {
+			return err
+		}
+		if err := touchPosts(tx, changed); err != nil {
+			return err
+		}
+		recordAudit(tx, c, "bulk_"+input.Action, "tag", tag.ID, nil, gin.H{"filter": input.Filter, "post_ids": changed})
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Bulk update failed", Data: err.Error()})
+		return
+	}
+	for _, postID := range changed {
+		reindexPost(postID)
+	}
+	if changed == nil {
+		changed = []uint{}
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Posts updated", Data: gin.H{
+		"matched":  len(postIDs),
+		"changed":  len(changed),
+		"post_ids": changed,
+	}})
+}
+
+// postFilterNames lists the filters of GET /posts
+func postFilterNames() []string {
+	names := make([]string, 0, len(postListOptions.Filters))
+	for name := range postListOptions.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
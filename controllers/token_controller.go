@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/models"
+	"beres/routers/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DTOs for binding
+type createTokenInput struct {
+	Name      string     `json:"name" binding:"required,max=255"`
+	Abilities []string   `json:"abilities" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"` // omit for a token that never expires
+	// IdleTimeout in seconds; omit or 0 to keep the token alive regardless of activity
+	IdleTimeout int `json:"idle_timeout" binding:"min=0"`
+}
+
+type renameTokenInput struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+// GetTokens lists the current user's personal access tokens
+func GetTokens(c *gin.Context) {
+	var tokens []models.PersonalAccessToken
+	if err := database.DB.Where("user_id = ?", currentUser(c).ID).Order("id").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch tokens", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Tokens retrieved", Data: tokens})
+}
+
+// CreateToken issues a named token limited to a subset of the caller's abilities
+func CreateToken(c *gin.Context) {
+	var input createTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	for _, ability := range input.Abilities {
+		if !models.ValidAbility(ability) {
+			c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Unknown ability", Data: ability})
+			return
+		}
+		// a token can never grant more than the role and the token creating it
+		if !middleware.Can(c, ability) {
+			c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "Ability not granted to you", Data: ability})
+			return
+		}
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "expires_at must be in the future"})
+		return
+	}
+	token := models.PersonalAccessToken{
+		UserID:      currentUser(c).ID,
+		Name:        input.Name,
+		Abilities:   strings.Join(input.Abilities, ","),
+		ExpiresAt:   input.ExpiresAt,
+		IdleTimeout: input.IdleTimeout,
+	}
+	raw, err := issueToken(database.DB, &token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Token creation failed", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, models.AuditCreate, "token", token.ID, nil, token)
+	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "Token created", Data: gin.H{"token": raw, "details": token}})
+}
+
+// RenameToken changes the name of one of the current user's tokens
+func RenameToken(c *gin.Context) {
+	token, ok := findOwnToken(c)
+	if !ok {
+		return
+	}
+	var input renameTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := token
+	if err := database.DB.Model(&token).Update("name", input.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to rename token", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, models.AuditUpdate, "token", token.ID, before, token)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Token renamed", Data: token})
+}
+
+// RevokeToken deletes one of the current user's tokens
+func RevokeToken(c *gin.Context) {
+	token, ok := findOwnToken(c)
+	if !ok {
+		return
+	}
+	if err := database.DB.Delete(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to revoke token", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, models.AuditDelete, "token", token.ID, token, nil)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Token revoked"})
+}
+
+// RevokeOtherTokens deletes every token of the current user except the one used for this request
+func RevokeOtherTokens(c *gin.Context) {
+	res := database.DB.
+		Where("user_id = ? AND token_hash <> ?", currentUser(c).ID, c.GetString("token_hash")).
+		Delete(&models.PersonalAccessToken{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to revoke tokens", Data: res.Error.Error()})
+		return
+	}
+	recordAudit(database.DB, c, "revoke_tokens", "user", currentUser(c).ID, nil, gin.H{"revoked": res.RowsAffected})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Other tokens revoked", Data: gin.H{"revoked": res.RowsAffected}})
+}
+
+// findOwnToken loads the token named by :id, writing a 400/404 response if it is not the caller's
+func findOwnToken(c *gin.Context) (models.PersonalAccessToken, bool) {
+	var token models.PersonalAccessToken
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid token ID"})
+		return token, false
+	}
+	if err := database.DB.Where("user_id = ?", currentUser(c).ID).First(&token, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Token not found"})
+		return token, false
+	}
+	return token, true
+}
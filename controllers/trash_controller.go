@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/models"
+	"beres/routers/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var trashListOptions = helpers.ListOptions{
+	Sortable:    map[string]string{"deleted_at": "deleted_at"},
+	DefaultSort: "-deleted_at",
+}
+
+// GetTrash lists the deleted rows of the :type trash, most recently deleted first
+func GetTrash(c *gin.Context) {
+	t, ok := trashType(c)
+	if !ok {
+		return
+	}
+	db := database.DB.Unscoped().Model(t.Model).Where("deleted_at IS NOT NULL")
+	if t.Entity == "post" && !middleware.Can(c, models.AbilityPostsDeleteOthers) {
+		db = db.Where("author_id = ?", currentUser(c).ID)
+	}
+	rows := t.NewList()
+	meta, err := helpers.Paginate(c, db, trashListOptions, rows)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch trash", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Trash retrieved", Data: rows, Meta: meta})
+}
+
+// RestoreTrashed takes row :id of the :type trash out of the trash
+func RestoreTrashed(c *gin.Context) {
+	t, row, id, ok := findTrashed(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")}
+		if err := tx.Unscoped().Model(row).Updates(updates).Error; err != nil {
+			return err
+		}
+		// the row shows up again in its menu's tree, its parent category or the posts filed under it
+		switch row := row.(type) {
+		case *models.MenuItem:
+			return touchMenuItems(tx, row.MenuID, row.ParentID)
+		case *models.Category:
+			if err := touchCategories(tx, row.ParentID); err != nil {
+				return err
+			}
+			return categoryTaxonomy.touchLinked(tx, row.ID)
+		case *models.Tag:
+			return tagTaxonomy.touchLinked(tx, row.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Restore failed", Data: err.Error()})
+		return
+	}
+	database.DB.First(row, id)
+	recordAudit(database.DB, c, models.AuditRestore, t.Entity, id, nil, row)
+	reindexTrashed(t, id)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Restored from trash", Data: row})
+}
+
+// PurgeTrashed permanently deletes row :id of the :type trash
+func PurgeTrashed(c *gin.Context) {
+	t, row, id, ok := findTrashed(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return t.Purge(tx, []uint{id})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Deletion failed", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, models.AuditPurge, t.Entity, id, row, nil)
+	reindexTrashed(t, id)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Deleted permanently"})
+}
+
+// trashType looks up the :type of trash, writing a 404/403 response if it is unknown or the
+// current user may not manage it
+func trashType(c *gin.Context) (models.Trashable, bool) {
+	t, ok := models.Trashables[c.Param("type")]
+	if !ok {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Unknown trash type"})
+		return t, false
+	}
+	if !middleware.Can(c, t.Ability) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "Forbidden", Data: gin.H{"required_ability": t.Ability}})
+		return t, false
+	}
+	return t, true
+}
+
+// findTrashed loads deleted row :id of the :type trash, writing a 400/403/404 response if that
+// fails or the current user may not manage it
+func findTrashed(c *gin.Context) (models.Trashable, interface{}, uint, bool) {
+	t, ok := trashType(c)
+	if !ok {
+		return t, nil, 0, false
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid ID"})
+		return t, nil, 0, false
+	}
+	row := t.NewRow()
+	if err := database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(row, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Not found in trash"})
+		return t, nil, 0, false
+	}
+	if post, isPost := row.(*models.Post); isPost && !canTouchPost(c, *post, models.AbilityPostsDeleteOthers) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You may only manage your own posts"})
+		return t, nil, 0, false
+	}
+	return t, row, uint(id), true
+}
+
+// reindexTrashed updates the post search index after a post, tag or category left the trash
+func reindexTrashed(t models.Trashable, id uint) {
+	switch t.Entity {
+	case "post":
+		reindexPost(id)
+	case "category":
+		reindexPostsOf("posts_categories", "category_id", id)
+	case "tag":
+		reindexPostsOf("posts_tags", "tag_id", id)
+	}
+}
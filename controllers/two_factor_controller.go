@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 8
+)
+
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+type passwordConfirmInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// EnableTwoFactor starts TOTP enrollment and returns the secret and its provisioning URI.
+// Two-factor is not enforced until ConfirmTwoFactor succeeds.
+func EnableTwoFactor(c *gin.Context) {
+	var input passwordConfirmInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	user := currentUser(c)
+	if !checkPassword(user, input.Password) {
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid password"})
+		return
+	}
+	if user.TwoFactorEnabled() {
+		c.JSON(http.StatusConflict, helpers.Response{Code: http.StatusConflict, Message: "Two-factor authentication is already enabled"})
+		return
+	}
+	secret, err := helpers.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to generate secret", Data: err.Error()})
+		return
+	}
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{"two_factor_secret": secret, "two_factor_last_counter": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to enable two-factor authentication", Data: err.Error()})
+		return
+	}
+	viper.SetDefault("APP_NAME", "Beres")
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Scan the QR code and confirm with a code", Data: gin.H{
+		"secret":           secret,
+		"provisioning_uri": helpers.TOTPProvisioningURI(viper.GetString("APP_NAME"), user.Email, secret),
+	}})
+}
+
+// ConfirmTwoFactor finishes enrollment with a first valid code and returns fresh recovery codes
+func ConfirmTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	user := currentUser(c)
+	if user.TwoFactorSecret == "" || user.TwoFactorEnabled() {
+		c.JSON(http.StatusConflict, helpers.Response{Code: http.StatusConflict, Message: "No two-factor enrollment in progress"})
+		return
+	}
+	counter, ok := helpers.VerifyTOTP(user.TwoFactorSecret, input.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Invalid code"})
+		return
+	}
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"two_factor_confirmed_at": time.Now(), "two_factor_last_counter": counter}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to confirm two-factor authentication", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, "two_factor_enable", "user", user.ID, nil, nil)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Two-factor authentication enabled", Data: gin.H{"recovery_codes": codes}})
+}
+
+// RegenerateRecoveryCodes invalidates the current recovery codes and returns new ones
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input passwordConfirmInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	user := currentUser(c)
+	if !checkPassword(user, input.Password) {
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid password"})
+		return
+	}
+	if !user.TwoFactorEnabled() {
+		c.JSON(http.StatusConflict, helpers.Response{Code: http.StatusConflict, Message: "Two-factor authentication is not enabled"})
+		return
+	}
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to generate recovery codes", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Recovery codes regenerated", Data: gin.H{"recovery_codes": codes}})
+}
+
+// DisableTwoFactor removes the TOTP secret and recovery codes
+func DisableTwoFactor(c *gin.Context) {
+	var input passwordConfirmInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	user := currentUser(c)
+	if !checkPassword(user, input.Password) {
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid password"})
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"two_factor_secret": "", "two_factor_confirmed_at": nil, "two_factor_last_counter": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactorRecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to disable two-factor authentication", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, "two_factor_disable", "user", user.ID, nil, nil)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Two-factor authentication disabled"})
+}
+
+// LoginTwoFactor exchanges the challenge returned by Login plus a TOTP or recovery code for a token
+func LoginTwoFactor(c *gin.Context) {
+	var input struct {
+		Challenge    string `json:"challenge" binding:"required"`
+		Code         string `json:"code" binding:"required_without=RecoveryCode"`
+		RecoveryCode string `json:"recovery_code"`
+		TokenName    string `json:"token_name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	var challenge models.VerificationToken
+	if err := database.DB.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", helpers.HashToken(input.Challenge), models.TokenPurposeTwoFactor, time.Now()).
+		First(&challenge).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid or expired challenge"})
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, challenge.UserID).Error; err != nil || !user.TwoFactorEnabled() {
+		c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid or expired challenge"})
+		return
+	}
+	if loginThrottled(c, user.Email) {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Code != "" {
+			if err := useTOTPCode(tx, user, input.Code); err != nil {
+				return err
+			}
+		} else if err := useRecoveryCode(tx, user.ID, input.RecoveryCode); err != nil {
+			return err
+		}
+		_, err := consumeVerificationToken(tx, input.Challenge, models.TokenPurposeTwoFactor)
+		return err
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) || errors.Is(err, errInvalidVerificationToken) {
+		if !recordLoginFailure(c, user.Email) {
+			c.JSON(http.StatusUnauthorized, helpers.Response{Code: http.StatusUnauthorized, Message: "Invalid two-factor code"})
+		}
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Login failed", Data: err.Error()})
+		return
+	}
+	completeLogin(c, user, input.TokenName)
+}
+
+// useTOTPCode accepts a code once: a step counter at or below the last accepted one is a replay
+func useTOTPCode(tx *gorm.DB, user models.User, code string) error {
+	counter, ok := helpers.VerifyTOTP(user.TwoFactorSecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return errInvalidTwoFactorCode
+	}
+	res := tx.Model(&models.User{}).
+		Where("id = ? AND two_factor_last_counter < ?", user.ID, counter).
+		Update("two_factor_last_counter", counter)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// useRecoveryCode marks an unused recovery code of the user as used
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	hash := helpers.HashToken(strings.ToLower(strings.TrimSpace(code)))
+	res := tx.Model(&models.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a new set, returning the raw codes
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.TwoFactorRecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := strings.ToLower(helpers.GenerateRandomString(10))
+		codes[i] = raw[:5] + "-" + raw[5:]
+		rows[i] = models.TwoFactorRecoveryCode{UserID: userID, CodeHash: helpers.HashToken(codes[i])}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
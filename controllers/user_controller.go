@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/infra/throttle"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// DTOs for binding
+type createUserInput struct {
+	Name     string `json:"name" binding:"required,max=255"`
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,min=8"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type updateUserInput struct {
+	Name      string `json:"name" binding:"required,max=255"`
+	Email     string `json:"email" binding:"required,email,max=255"`
+	Role      string `json:"role" binding:"required"`
+	AvatarURL string `json:"avatar_url" binding:"omitempty,url,max=255"`
+}
+
+type unlockInput struct {
+	// IPs are client IPs whose lockouts are lifted along with the account's
+	IPs []string `json:"ips" binding:"omitempty,dive,ip"`
+}
+
+var userListOptions = helpers.ListOptions{
+	Sortable: map[string]string{"name": "name", "email": "email", "created_at": "created_at"},
+	Filters: map[string]helpers.Filter{
+		"role": helpers.Equals("role"),
+		"search": func(db *gorm.DB, q string) (*gorm.DB, error) {
+			return db.Scopes(helpers.Search(q, "name", "email")), nil
+		},
+	},
+	DefaultSort: "id",
+}
+
+// GetUsers lists users, optionally filtered by role or a name/email search, one page at a time
+func GetUsers(c *gin.Context) {
+	var users []models.User
+	meta, err := helpers.Paginate(c, database.DB, userListOptions, &users)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch users", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Users retrieved", Data: users, Meta: meta})
+}
+
+// GetUserByID returns a single user
+func GetUserByID(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "User retrieved", Data: user})
+}
+
+// CreateUser creates an account with a chosen role. Admin-created accounts count as verified.
+func CreateUser(c *gin.Context) {
+	var input createUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	if !models.ValidRole(input.Role) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Unknown role", Data: input.Role})
+		return
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	user := models.User{
+		Name:            input.Name,
+		Email:           input.Email,
+		PasswordHash:    string(hash),
+		Role:            input.Role,
+		EmailVerifiedAt: ptrTime(time.Now()),
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		userWriteError(c, err, "Failed to create user")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditCreate, "user", user.ID, nil, user)
+	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "User created", Data: user})
+}
+
+// UpdateUser updates a user's profile and role from a full body (PUT) or a merge patch (PATCH)
+func UpdateUser(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	input := updateUserInput{Name: user.Name, Email: user.Email, Role: user.Role, AvatarURL: user.AvatarURL}
+	if err := helpers.BindUpdate(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	if !models.ValidRole(input.Role) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Unknown role", Data: input.Role})
+		return
+	}
+	if user.ID == currentUser(c).ID && input.Role != user.Role {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "You cannot change your own role"})
+		return
+	}
+	before := user
+	updates := map[string]interface{}{
+		"Name":      input.Name,
+		"Email":     input.Email,
+		"Role":      input.Role,
+		"AvatarURL": input.AvatarURL,
+	}
+	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		userWriteError(c, err, "Failed to update user")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditUpdate, "user", user.ID, before, user)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "User updated", Data: user})
+}
+
+// DeleteUser deletes a user who owns no posts; deactivate users with content instead
+func DeleteUser(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	if user.ID == currentUser(c).ID {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "You cannot delete yourself"})
+		return
+	}
+	var posts int64
+	database.DB.Unscoped().Model(&models.Post{}).Where("author_id = ?", user.ID).Count(&posts)
+	if posts > 0 {
+		c.JSON(http.StatusConflict, helpers.Response{Code: http.StatusConflict, Message: "User still owns posts; deactivate the account instead", Data: gin.H{"posts": posts}})
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, owned := range []interface{}{
+			&models.PersonalAccessToken{}, &models.RefreshToken{}, &models.VerificationToken{}, &models.TwoFactorRecoveryCode{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(owned).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to delete user", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, models.AuditDelete, "user", user.ID, user, nil)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "User deleted"})
+}
+
+// DeactivateUser blocks a user from signing in and invalidates all of their tokens immediately
+func DeactivateUser(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	if user.ID == currentUser(c).ID {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "You cannot deactivate yourself"})
+		return
+	}
+	before := user
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("deactivated_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to deactivate user", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, "deactivate", "user", user.ID, before, user)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "User deactivated", Data: user})
+}
+
+// ActivateUser lets a deactivated user sign in again
+func ActivateUser(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	before := user
+	if err := database.DB.Model(&user).Update("deactivated_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to activate user", Data: err.Error()})
+		return
+	}
+	recordAudit(database.DB, c, "activate", "user", user.ID, before, user)
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "User activated", Data: user})
+}
+
+// UnlockUser lifts the login lockout on the user's account. The client IPs that recently failed
+// to sign in to it are listed but stay locked, as they may be an attacker's; only the IPs named
+// in the optional body are lifted too.
+func UnlockUser(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	var input unlockInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	email := loginEmailKey(user.Email)
+	throttle.LoginEmail.Reset(email)
+	ips := append([]string{}, input.IPs...)
+	for _, ip := range ips {
+		throttle.LoginIP.Reset(ip)
+	}
+	failed := throttle.LoginIPsByEmail.Get(email)
+	sort.Strings(failed)
+	if failed == nil {
+		failed = []string{}
+	}
+	recordAudit(database.DB, c, "unlock", "user", user.ID, nil, gin.H{"ips": ips})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "User unlocked", Data: gin.H{"ips": ips, "failed_ips": failed}})
+}
+
+// userWriteError responds to an error from writing a user; the email is the only unique column
+func userWriteError(c *gin.Context, err error, message string) {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, helpers.Response{Code: http.StatusConflict, Message: "Email is already in use", Data: gin.H{"email": "already in use"}})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: message, Data: err.Error()})
+}
+
+// findUser loads the user named by :id, writing a 400/404 response if that fails
+func findUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid user ID"})
+		return user, false
+	}
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "User not found"})
+		return user, false
+	}
+	return user, true
+}
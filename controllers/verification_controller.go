@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/infra/logger"
+	"beres/infra/mailer"
+	"beres/infra/throttle"
+	"beres/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerifyTTL   = 24 * time.Hour
+	passwordResetTTL = time.Hour
+)
+
+var errInvalidVerificationToken = errors.New("invalid or expired token")
+
+// ForgotPassword mails a password reset link. It answers the same way whether or not the email exists.
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	// unknown emails count too, so the limit gives away nothing about which accounts exist
+	if mailThrottled(c, input.Email) {
+		return
+	}
+	var user models.User
+	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err == nil {
+		raw, err := issueVerificationToken(user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+		if err == nil {
+			err = mailer.Send(mailer.Message{
+				To:      user.Email,
+				Subject: "Reset your password",
+				Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+					user.Name, passwordResetTTL, appLink("/password/reset", raw)),
+			})
+		}
+		if err != nil {
+			logger.Errorf("password reset mail for user %d failed: %v", user.ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "If the account exists, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and revokes every session
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=8"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		vt, err := consumeVerificationToken(tx, input.Token, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", vt.UserID).Update("password_hash", string(hash)).Error; err != nil {
+			return err
+		}
+		recordAuditBy(tx, c, vt.UserID, "password_reset", "user", vt.UserID, nil, nil)
+		return revokeUserSessions(tx, vt.UserID)
+	})
+	if errors.Is(err, errInvalidVerificationToken) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Password reset failed", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Password has been reset"})
+}
+
+// VerifyEmail marks the owner of a verification token as verified
+func VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		vt, err := consumeVerificationToken(tx, input.Token, models.TokenPurposeEmailVerify)
+		if err != nil {
+			return err
+		}
+		var before, after models.User
+		if err := tx.First(&before, vt.UserID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidVerificationToken
+		} else if err != nil {
+			return err
+		}
+		after = before
+		after.EmailVerifiedAt = ptrTime(time.Now())
+		if err := tx.Model(&models.User{}).Where("id = ?", vt.UserID).Update("email_verified_at", after.EmailVerifiedAt).Error; err != nil {
+			return err
+		}
+		recordAuditBy(tx, c, vt.UserID, "email_verify", "user", vt.UserID, before, after)
+		return nil
+	})
+	if errors.Is(err, errInvalidVerificationToken) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Verification failed", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Email verified"})
+}
+
+// ResendVerification mails a fresh verification link to the current user
+func ResendVerification(c *gin.Context) {
+	user := currentUser(c)
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Email already verified"})
+		return
+	}
+	if mailThrottled(c, user.Email) {
+		return
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to send verification email", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Verification email sent"})
+}
+
+// mailThrottled counts a mail requested for email from the client IP. While either is over its
+// limit it writes a 429 instead and reports true.
+func mailThrottled(c *gin.Context, email string) bool {
+	key := loginEmailKey(email)
+	if wait := max(throttle.MailEmail.RetryAfter(key), throttle.MailIP.RetryAfter(c.ClientIP())); wait > 0 {
+		tooManyRequests(c, wait, "Too many emails requested")
+		return true
+	}
+	throttle.MailEmail.Fail(key)
+	throttle.MailIP.Fail(c.ClientIP())
+	return false
+}
+
+func sendVerificationEmail(user models.User) error {
+	raw, err := issueVerificationToken(user.ID, models.TokenPurposeEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.Name, emailVerifyTTL, appLink("/email/verify", raw)),
+	})
+}
+
+// issueVerificationToken stores a new token for purpose, replacing any earlier unused one
+func issueVerificationToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	raw := helpers.GenerateRandomString(40)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).Delete(&models.VerificationToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.VerificationToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: helpers.HashToken(raw),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	return raw, err
+}
+
+// consumeVerificationToken marks a valid token as used; it returns errInvalidVerificationToken otherwise
+func consumeVerificationToken(tx *gorm.DB, raw, purpose string) (models.VerificationToken, error) {
+	var vt models.VerificationToken
+	err := tx.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", helpers.HashToken(raw), purpose, time.Now()).
+		First(&vt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return vt, errInvalidVerificationToken
+	}
+	if err != nil {
+		return vt, err
+	}
+	// the used_at guard makes concurrent redemption of the same token fail
+	res := tx.Model(&vt).Where("used_at IS NULL").Update("used_at", time.Now())
+	if res.Error != nil {
+		return vt, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return vt, errInvalidVerificationToken
+	}
+	return vt, nil
+}
+
+// appLink builds a link to the frontend carrying a token in its query string
+func appLink(path, token string) string {
+	viper.SetDefault("APP_URL", "http://localhost:8000")
+	return viper.GetString("APP_URL") + path + "?token=" + url.QueryEscape(token)
+}
@@ -20,14 +20,25 @@ type widgetInput struct {
 	SortOrder int    `json:"sort_order"`
 }
 
-// GetWidgets returns all widgets
+var widgetListOptions = helpers.ListOptions{
+	Sortable: map[string]string{"sort_order": "sort_order", "title": "title", "created_at": "created_at"},
+	Filters: map[string]helpers.Filter{
+		"type":     helpers.Equals("type"),
+		"position": helpers.Equals("position"),
+	},
+	DefaultSort: "sort_order",
+}
+
+// GetWidgets lists widgets, one page at a time
 func GetWidgets(c *gin.Context) {
 	var widgets []models.Widget
-	if err := database.DB.Find(&widgets).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to fetch widgets", Data: err.Error()})
+	meta, err := helpers.Paginate(c, database.DB, widgetListOptions, &widgets)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch widgets", Data: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Widgets retrieved", Data: widgets})
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Widgets retrieved", Data: widgets, Meta: meta})
 }
 
 // GetWidgetByID returns a widget by its ID
@@ -42,6 +53,9 @@ func GetWidgetByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Widget not found"})
 		return
 	}
+	if notModified(c, widget.ID, widget.Version) {
+		return
+	}
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Widget retrieved", Data: widget})
 }
 
@@ -63,33 +77,53 @@ func CreateWidget(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to create widget", Data: err.Error()})
 		return
 	}
+	recordAudit(database.DB, c, models.AuditCreate, "widget", widget.ID, nil, widget)
 	c.JSON(http.StatusCreated, helpers.Response{Code: http.StatusCreated, Message: "Widget created", Data: widget})
 }
 
-// UpdateWidget updates an existing widget by ID
+// UpdateWidget updates an existing widget from a full body (PUT) or a merge patch (PATCH)
 func UpdateWidget(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid widget ID"})
 		return
 	}
-	var input widgetInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
-		return
-	}
 	var widget models.Widget
 	if err := database.DB.First(&widget, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Widget not found"})
 		return
 	}
-	database.DB.Model(&widget).Updates(models.Widget{
-		Type:      input.Type,
-		Title:     input.Title,
-		Content:   input.Content,
-		Position:  input.Position,
-		SortOrder: input.SortOrder,
-	})
+	if !ifMatch(c, widget.ID, widget.Version) {
+		return
+	}
+	input := widgetInput{
+		Type:      widget.Type,
+		Title:     widget.Title,
+		Content:   widget.Content,
+		Position:  widget.Position,
+		SortOrder: widget.SortOrder,
+	}
+	if err := helpers.BindUpdate(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	before := widget
+	err = versioned(database.DB.Model(&widget).Where("version = ?", before.Version).
+		Select("Type", "Title", "Content", "Position", "SortOrder", "Version").
+		Updates(models.Widget{
+			Versioned: models.Versioned{Version: before.Version + 1},
+			Type:      input.Type,
+			Title:     input.Title,
+			Content:   input.Content,
+			Position:  input.Position,
+			SortOrder: input.SortOrder,
+		}))
+	if err != nil {
+		writeError(c, err, &models.Widget{}, widget.ID, "Failed to update widget")
+		return
+	}
+	recordAudit(database.DB, c, models.AuditUpdate, "widget", widget.ID, before, widget)
+	c.Header("ETag", helpers.ETag(widget.ID, widget.Version))
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Widget updated", Data: widget})
 }
 
@@ -100,9 +134,18 @@ func DeleteWidget(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid widget ID"})
 		return
 	}
-	if err := database.DB.Delete(&models.Widget{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.Response{Code: http.StatusInternalServerError, Message: "Failed to delete widget", Data: err.Error()})
+	var widget models.Widget
+	if err := database.DB.First(&widget, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Widget not found"})
+		return
+	}
+	if !ifMatch(c, widget.ID, widget.Version) {
+		return
+	}
+	if err := versioned(database.DB.Where("version = ?", widget.Version).Delete(&widget)); err != nil {
+		writeError(c, err, &models.Widget{}, widget.ID, "Failed to delete widget")
 		return
 	}
+	recordAudit(database.DB, c, models.AuditDelete, "widget", widget.ID, widget, nil)
 	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Widget deleted"})
 }
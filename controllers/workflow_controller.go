@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/database"
+	"beres/infra/logger"
+	"beres/models"
+	"beres/routers/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type transitionInput struct {
+	Action string `json:"action" binding:"required"`
+	Note   string `json:"note" binding:"max=2000"`
+}
+
+// inReview are the statuses of posts between submission and publication
+var inReview = []string{models.PostStatusPendingReview, models.PostStatusApproved}
+
+func isInReview(status string) bool {
+	return status == models.PostStatusPendingReview || status == models.PostStatusApproved
+}
+
+// reviewQueueOptions lists the longest-waiting submissions first
+var reviewQueueOptions = helpers.ListOptions{
+	Sortable:    postListOptions.Sortable,
+	Filters:     map[string]helpers.Filter{"author_id": helpers.Equals("author_id")},
+	DefaultSort: "updated_at",
+	Preload:     postListOptions.Preload,
+}
+
+var transitionListOptions = helpers.ListOptions{
+	Sortable:    map[string]string{"created_at": "created_at"},
+	DefaultSort: "-id",
+}
+
+// GetReviewQueue lists the posts awaiting review
+func GetReviewQueue(c *gin.Context) {
+	var posts []models.Post
+	db := database.DB.Scopes(readablePosts(c)).Where("posts.status = ?", models.PostStatusPendingReview)
+	meta, err := helpers.Paginate(c, db, reviewQueueOptions, &posts)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch review queue", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Review queue retrieved", Data: posts, Meta: meta})
+}
+
+// GetPostTransitions lists the status changes of a post, newest first
+func GetPostTransitions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid post ID"})
+		return
+	}
+	var post models.Post
+	if err := database.DB.First(&post, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Post not found"})
+		return
+	}
+	if !canTouchPost(c, post, models.AbilityPostsEditOthers) && !middleware.Can(c, models.AbilityPostsReview) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You may only view the history of your own posts"})
+		return
+	}
+	var transitions []models.PostTransition
+	meta, err := helpers.Paginate(c, database.DB.Where("post_id = ?", post.ID), transitionListOptions, &transitions)
+	if err != nil {
+		code := helpers.QueryErrorStatus(err)
+		c.JSON(code, helpers.Response{Code: code, Message: "Failed to fetch transitions", Data: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Transitions retrieved", Data: transitions, Meta: meta})
+}
+
+// TransitionPost takes a step of the editorial workflow (models.PostWorkflow) on a post,
+// recording it with the actor and an optional note
+func TransitionPost(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid post ID"})
+		return
+	}
+	var input transitionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.Response{Code: http.StatusBadRequest, Message: "Invalid input", Data: err.Error()})
+		return
+	}
+	var post models.Post
+	if err := database.DB.Preload("Categories").Preload("Tags").First(&post, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, helpers.Response{Code: http.StatusNotFound, Message: "Post not found"})
+		return
+	}
+	step, ok := models.FindWorkflowStep(input.Action, post.Status)
+	if !ok {
+		c.JSON(http.StatusConflict, helpers.Response{Code: http.StatusConflict, Message: "Action not allowed for a post in this status", Data: gin.H{"status": post.Status, "actions": workflowActions(post.Status)}})
+		return
+	}
+	if !middleware.Can(c, step.Ability) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "Forbidden", Data: gin.H{"required_ability": step.Ability}})
+		return
+	}
+	if !step.AnyPost && !canTouchPost(c, post, models.AbilityPostsEditOthers) {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You may only edit your own posts"})
+		return
+	}
+	input.Note = strings.TrimSpace(input.Note)
+	if step.NoteRequired && input.Note == "" {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: "A note is required to " + step.Action + " a post"})
+		return
+	}
+	if !ifMatch(c, post.ID, post.Version) {
+		return
+	}
+	// publishing an approved post honours its publication times like a direct publish does
+	next := postInputOf(post)
+	next.Status = step.To
+	if msg := checkSchedule(&next); msg != "" {
+		c.JSON(http.StatusUnprocessableEntity, helpers.Response{Code: http.StatusUnprocessableEntity, Message: msg})
+		return
+	}
+	before := post
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"Status":    next.Status,
+			"PublishAt": next.PublishAt,
+			"Version":   before.Version + 1,
+		}
+		if err := versioned(tx.Model(&post).Where("version = ?", before.Version).Updates(updates)); err != nil {
+			return err
+		}
+		if err := tx.Preload("Author").Preload("Categories").Preload("Tags").First(&post, post.ID).Error; err != nil {
+			return err
+		}
+		recordTransition(tx, c, post.ID, step.Action, before.Status, post.Status, input.Note)
+		recordAudit(tx, c, step.Action, "post", post.ID, before, post)
+		return nil
+	})
+	if err != nil {
+		writeError(c, err, &models.Post{}, post.ID, "Transition failed")
+		return
+	}
+	reindexPost(post.ID)
+	c.Header("ETag", helpers.ETag(post.ID, post.Version))
+	c.JSON(http.StatusOK, helpers.Response{Code: http.StatusOK, Message: "Post moved to " + post.Status, Data: post})
+}
+
+// statusStep checks a change of a post's status from one status to another made through create
+// or update, writing a 403/409 response and reporting false if it is not allowed. Posts only
+// enter and leave review through workflow steps, whose action it returns; other changes are no
+// step ("") and need the ability canSetStatus asks for. Steps that need a note are left to
+// POST /posts/:id/transitions.
+func statusStep(c *gin.Context, from, to string) (string, bool) {
+	if !isInReview(from) && !isInReview(to) {
+		return "", canSetStatus(c, to)
+	}
+	// publishing with a future publish_at schedules the post
+	if to == models.PostStatusScheduled {
+		to = models.PostStatusPublish
+	}
+	var denied *models.WorkflowStep
+	for i, step := range models.PostWorkflow {
+		if step.To != to || step.NoteRequired || !containsStatus(step.From, from) {
+			continue
+		}
+		if middleware.Can(c, step.Ability) {
+			return step.Action, true
+		}
+		denied = &models.PostWorkflow[i]
+	}
+	if denied != nil {
+		c.JSON(http.StatusForbidden, helpers.Response{Code: http.StatusForbidden, Message: "You are not allowed to " + denied.Action + " this post", Data: gin.H{"required_ability": denied.Ability}})
+		return "", false
+	}
+	c.JSON(http.StatusConflict, helpers.Response{Code: http.StatusConflict, Message: "Posts enter and leave review through the workflow", Data: gin.H{"status": from, "actions": workflowActions(from)}})
+	return "", false
+}
+
+// needsReview reports whether input edits post in a way that must be reviewed again: the post is
+// approved, published or scheduled and the current user may not publish
+func needsReview(c *gin.Context, post models.Post, input postInput) bool {
+	switch post.Status {
+	case models.PostStatusApproved, models.PostStatusPublish, models.PostStatusScheduled:
+	default:
+		return false
+	}
+	if middleware.Can(c, models.AbilityPostsPublish) {
+		return false
+	}
+	current := postInputOf(post)
+	return input.Title != current.Title || input.Slug != "" && input.Slug != current.Slug ||
+		input.Content != current.Content || input.Excerpt != current.Excerpt ||
+		input.AuthorID != current.AuthorID || input.FeaturedImage != current.FeaturedImage ||
+		input.Password != nil && (*input.Password != "" || post.PasswordHash != "") ||
+		!sameTime(input.PublishAt, current.PublishAt) || !sameTime(input.UnpublishAt, current.UnpublishAt) ||
+		!sameIDs(input.CategoryIDs, current.CategoryIDs) || !sameIDs(input.TagIDs, current.TagIDs)
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTime reports whether two optional times are equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// sameIDs reports whether two ID lists hold the same IDs, in any order
+func sameIDs(a, b []uint) bool {
+	return len(missingIDs(a, b)) == 0 && len(missingIDs(b, a)) == 0
+}
+
+// workflowActions lists the workflow actions that apply to a post in status
+func workflowActions(status string) []string {
+	actions := []string{}
+	for _, step := range models.PostWorkflow {
+		if containsStatus(step.From, status) {
+			actions = append(actions, step.Action)
+		}
+	}
+	return actions
+}
+
+// recordTransition records that the current user moved a post from one status to another.
+// Failures are logged rather than failing the request that moved the post.
+func recordTransition(tx *gorm.DB, c *gin.Context, postID uint, action, from, to, note string) {
+	transition := models.PostTransition{PostID: postID, Action: action, FromStatus: from, ToStatus: to, Note: note}
+	if user, ok := c.Get("current_user"); ok {
+		id := user.(models.User).ID
+		transition.UserID = &id
+	}
+	if err := tx.Create(&transition).Error; err != nil {
+		logger.Errorf("transition of post %d failed: %v", postID, err)
+	}
+}
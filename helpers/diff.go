@@ -0,0 +1,101 @@
+package helpers
+
+import "strings"
+
+// Diff operations reported by LineDiff.
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffCells bounds the LCS table; larger changes are reported as a full replacement
+const maxDiffCells = 4 << 20
+
+// DiffLine is one line of a diff. OldLine and NewLine are 1-based and 0 where the line is absent.
+type DiffLine struct {
+	Op      string `json:"op"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	Text    string `json:"text"`
+}
+
+// LineDiff compares two texts line by line using their longest common subsequence.
+func LineDiff(a, b string) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+
+	// the common head and tail need no table
+	head := 0
+	for head < len(x) && head < len(y) && x[head] == y[head] {
+		head++
+	}
+	tail := 0
+	for tail < len(x)-head && tail < len(y)-head && x[len(x)-1-tail] == y[len(y)-1-tail] {
+		tail++
+	}
+
+	var out []DiffLine
+	for i := 0; i < head; i++ {
+		out = append(out, DiffLine{Op: DiffEqual, OldLine: i + 1, NewLine: i + 1, Text: x[i]})
+	}
+	out = append(out, diffMiddle(x[head:len(x)-tail], y[head:len(y)-tail], head)...)
+	for i := 0; i < tail; i++ {
+		oi, ni := len(x)-tail+i, len(y)-tail+i
+		out = append(out, DiffLine{Op: DiffEqual, OldLine: oi + 1, NewLine: ni + 1, Text: x[oi]})
+	}
+	return out
+}
+
+// diffMiddle diffs the differing middle part of two texts; offset is the number of lines before it
+func diffMiddle(x, y []string, offset int) []DiffLine {
+	n, m := len(x), len(y)
+	var out []DiffLine
+	if n*m > maxDiffCells {
+		for i, line := range x {
+			out = append(out, DiffLine{Op: DiffDelete, OldLine: offset + i + 1, Text: line})
+		}
+		for j, line := range y {
+			out = append(out, DiffLine{Op: DiffInsert, NewLine: offset + j + 1, Text: line})
+		}
+		return out
+	}
+
+	// lcs[i][j] is the length of the LCS of x[i:] and y[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && x[i] == y[j]:
+			out = append(out, DiffLine{Op: DiffEqual, OldLine: offset + i + 1, NewLine: offset + j + 1, Text: x[i]})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, DiffLine{Op: DiffDelete, OldLine: offset + i + 1, Text: x[i]})
+			i++
+		default:
+			out = append(out, DiffLine{Op: DiffInsert, NewLine: offset + j + 1, Text: y[j]})
+			j++
+		}
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
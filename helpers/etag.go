@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ETag is the strong entity tag of version of the row with the given id.
+func ETag(id, version uint) string {
+	return fmt.Sprintf(`"%d.%d"`, id, version)
+}
+
+// VariantETag is the entity tag of a variant of that version, such as one with fields withheld,
+// which must not be taken for the full representation.
+func VariantETag(id, version uint, variant string) string {
+	return fmt.Sprintf(`"%d.%d-%s"`, id, version, variant)
+}
+
+// ETagMatches reports whether an If-Match or If-None-Match header value is "*" or lists etag.
+// If-None-Match compares weakly, ignoring W/ prefixes; If-Match compares strongly, so a weak tag never matches.
+func ETagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package helpers
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Change is one field's value before and after a write.
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// JSONDiff compares the top-level fields of two JSON objects and returns those that differ.
+// A nil or empty side counts as an object without fields.
+func JSONDiff(before, after []byte) map[string]Change {
+	var b, a map[string]interface{}
+	if len(before) > 0 {
+		_ = json.Unmarshal(before, &b)
+	}
+	if len(after) > 0 {
+		_ = json.Unmarshal(after, &a)
+	}
+	changes := map[string]Change{}
+	for k, from := range b {
+		if to, ok := a[k]; !ok || !reflect.DeepEqual(from, to) {
+			changes[k] = Change{From: from, To: a[k]}
+		}
+	}
+	for k, to := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{From: nil, To: to}
+		}
+	}
+	return changes
+}
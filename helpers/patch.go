@@ -0,0 +1,84 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// MergePatch applies the RFC 7396 JSON merge patch patch to the JSON document target:
+// members of patch replace those of target, objects are merged recursively and null removes a member.
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var t, p interface{}
+	if err := decodeJSON(target, &t); err != nil {
+		return nil, err
+	}
+	if err := decodeJSON(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(t, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergeValue(t[k], v)
+	}
+	return t
+}
+
+// decodeJSON keeps numbers as json.Number so large IDs survive a round trip
+func decodeJSON(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// BindUpdate binds the body of an update request into input, a pointer to an input struct
+// holding the resource's current values. A PUT body replaces input as ShouldBindJSON would.
+// A PATCH body is a JSON merge patch applied to input: members left out keep their value and
+// null resets a field to its zero value. Either way the result is validated.
+func BindUpdate(c *gin.Context, input interface{}) error {
+	if c.Request.Method != http.MethodPatch {
+		resetValue(input)
+		return c.ShouldBindJSON(input)
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	current, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	merged, err := MergePatch(current, body)
+	if err != nil {
+		return err
+	}
+	resetValue(input)
+	if err := json.Unmarshal(merged, input); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(input)
+}
+
+func resetValue(ptr interface{}) {
+	v := reflect.ValueOf(ptr).Elem()
+	v.Set(reflect.Zero(v.Type()))
+}
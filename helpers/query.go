@@ -0,0 +1,281 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// Meta describes the page of a list response.
+// Page-based listings fill Page/TotalPages/Next/Prev, cursor-based ones NextCursor/Next.
+type Meta struct {
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page"`
+	Total      int64  `json:"total"`
+	TotalPages int    `json:"total_pages,omitempty"`
+	Next       string `json:"next,omitempty"`
+	Prev       string `json:"prev,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Filter narrows db for the value of one query parameter.
+type Filter func(db *gorm.DB, value string) (*gorm.DB, error)
+
+// ListOptions declares what a list endpoint accepts.
+type ListOptions struct {
+	Sortable    map[string]string // ?sort= field name -> column
+	Filters     map[string]Filter // query parameter -> filter
+	DefaultSort string            // same syntax as ?sort=, e.g. "-created_at"
+	Preload     []string
+}
+
+// QueryError is returned for invalid list parameters; it maps to 400 Bad Request.
+type QueryError struct {
+	msg string
+}
+
+func (e *QueryError) Error() string { return e.msg }
+
+// QueryErrorf builds a QueryError for a rejected list parameter.
+func QueryErrorf(format string, args ...interface{}) error {
+	return &QueryError{msg: fmt.Sprintf(format, args...)}
+}
+
+// QueryErrorStatus returns the HTTP status for an error from Paginate.
+func QueryErrorStatus(err error) int {
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Equals filters on column = value.
+func Equals(column string) Filter {
+	return func(db *gorm.DB, value string) (*gorm.DB, error) {
+		return db.Where(column+" = ?", value), nil
+	}
+}
+
+// NullableEquals filters on column = value, or column IS NULL when value is "null".
+func NullableEquals(column string) Filter {
+	return func(db *gorm.DB, value string) (*gorm.DB, error) {
+		if value == "null" {
+			return db.Where(column + " IS NULL"), nil
+		}
+		return db.Where(column+" = ?", value), nil
+	}
+}
+
+// Bool filters on a boolean column from "true"/"false"/"1"/"0".
+func Bool(column string) Filter {
+	return func(db *gorm.DB, value string) (*gorm.DB, error) {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, QueryErrorf("invalid boolean %q", value)
+		}
+		return db.Where(column+" = ?", b), nil
+	}
+}
+
+// Paginate applies the request's filters, sort and page (or cursor) to db, loads the rows
+// into dest (a pointer to a slice of models with an ID field) and describes the page.
+//
+// Supported parameters: page, per_page, cursor, sort=-created_at,title and opts.Filters.
+// Passing cursor (empty for the first page) switches to keyset pagination on id.
+func Paginate(c *gin.Context, db *gorm.DB, opts ListOptions, dest interface{}) (*Meta, error) {
+	perPage, err := PerPage(c)
+	if err != nil {
+		return nil, err
+	}
+
+	db = db.Model(dest)
+	for param, filter := range opts.Filters {
+		value, ok := c.GetQuery(param)
+		if !ok || value == "" {
+			continue
+		}
+		if db, err = filter(db, value); err != nil {
+			return nil, err
+		}
+	}
+
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	query := db
+	for _, p := range opts.Preload {
+		query = query.Preload(p)
+	}
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		// keyset pages follow id whatever opts.DefaultSort is; without a sort, newest first
+		return paginateCursor(c, query, c.DefaultQuery("sort", "-id"), cursor, perPage, total, dest)
+	}
+	sort := c.DefaultQuery("sort", opts.DefaultSort)
+
+	page, err := Page(c)
+	if err != nil {
+		return nil, err
+	}
+	order, err := orderClause(sort, opts.Sortable)
+	if err != nil {
+		return nil, err
+	}
+	if err := query.Order(order).Offset((page - 1) * perPage).Limit(perPage).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	return PageMeta(c, page, perPage, total), nil
+}
+
+// PerPage reads ?per_page, which defaults to 20 and may not exceed 100.
+func PerPage(c *gin.Context) (int, error) {
+	v := c.Query("per_page")
+	if v == "" {
+		return defaultPerPage, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxPerPage {
+		return 0, QueryErrorf("per_page must be between 1 and %d", maxPerPage)
+	}
+	return n, nil
+}
+
+// IntQuery reads integer query parameter name, which defaults to def and must lie within [min, max].
+func IntQuery(c *gin.Context, name string, def, min, max int) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, QueryErrorf("%s must be between %d and %d", name, min, max)
+	}
+	return n, nil
+}
+
+// Page reads ?page, which starts at 1.
+func Page(c *gin.Context) (int, error) {
+	v := c.Query("page")
+	if v == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, QueryErrorf("page must be a positive integer")
+	}
+	return n, nil
+}
+
+// PageMeta describes one page of a page-based listing of total rows.
+func PageMeta(c *gin.Context, page, perPage int, total int64) *Meta {
+	meta := &Meta{Page: page, PerPage: perPage, Total: total, TotalPages: int((total + int64(perPage) - 1) / int64(perPage))}
+	if page < meta.TotalPages {
+		meta.Next = pageLink(c, "page", strconv.Itoa(page+1))
+	}
+	if page > 1 {
+		meta.Prev = pageLink(c, "page", strconv.Itoa(page-1))
+	}
+	return meta
+}
+
+// paginateCursor loads the rows after the id encoded in cursor, ordered by id
+func paginateCursor(c *gin.Context, db *gorm.DB, sort, cursor string, perPage int, total int64, dest interface{}) (*Meta, error) {
+	desc := false
+	switch sort {
+	case "", "id":
+	case "-id":
+		desc = true
+	default:
+		return nil, QueryErrorf("cursor pagination only supports sort=id or sort=-id")
+	}
+	if cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, QueryErrorf("invalid cursor")
+		}
+		after, err := strconv.ParseUint(string(raw), 10, 64)
+		if err != nil {
+			return nil, QueryErrorf("invalid cursor")
+		}
+		if desc {
+			db = db.Where("id < ?", after)
+		} else {
+			db = db.Where("id > ?", after)
+		}
+	}
+	order := "id"
+	if desc {
+		order = "id DESC"
+	}
+	// one extra row tells whether another page follows
+	if err := db.Order(order).Limit(perPage + 1).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	meta := &Meta{PerPage: perPage, Total: total}
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() > perPage {
+		rows.Set(rows.Slice(0, perPage))
+		last := reflect.Indirect(rows.Index(perPage - 1)).FieldByName("ID")
+		meta.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprint(last.Interface())))
+		meta.Next = pageLink(c, "cursor", meta.NextCursor)
+	}
+	return meta, nil
+}
+
+// orderClause turns "-created_at,title" into an ORDER BY list, always ending with id for a stable order
+func orderClause(sort string, sortable map[string]string) (string, error) {
+	var parts []string
+	hasID := false
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		dir := "ASC"
+		if strings.HasPrefix(field, "-") {
+			dir, field = "DESC", field[1:]
+		}
+		column, ok := sortable[field]
+		if !ok && field == "id" {
+			column, ok = "id", true
+		}
+		if !ok {
+			return "", QueryErrorf("cannot sort by %q", field)
+		}
+		hasID = hasID || column == "id"
+		parts = append(parts, column+" "+dir)
+	}
+	if !hasID {
+		parts = append(parts, "id ASC")
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// pageLink returns the current request URL with one query parameter replaced
+func pageLink(c *gin.Context, key, value string) string {
+	u := *c.Request.URL
+	q := u.Query()
+	q.Set(key, value)
+	if key == "cursor" {
+		q.Del("page")
+	}
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
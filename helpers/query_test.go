@@ -0,0 +1,153 @@
+package helpers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeDB answers COUNT queries with total and every other query with one id column holding ids,
+// recording the last such query with its arguments.
+type fakeDB struct {
+	total int64
+	ids   []int64
+	query string
+	args  []driver.NamedValue
+}
+
+func (f *fakeDB) Open(string) (driver.Conn, error)             { return fakeConn{f}, nil }
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return f }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if strings.HasPrefix(query, "SELECT count(*)") {
+		return &fakeRows{column: "count(*)", values: []int64{c.db.total}}, nil
+	}
+	c.db.query, c.db.args = query, args
+	return &fakeRows{column: "id", values: c.db.ids}, nil
+}
+
+type fakeRows struct {
+	column string
+	values []int64
+	next   int
+}
+
+func (r *fakeRows) Columns() []string { return []string{r.column} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.values) {
+		return io.EOF
+	}
+	dest[0] = r.values[r.next]
+	r.next++
+	return nil
+}
+
+type pageRow struct {
+	ID uint
+}
+
+func paginateWith(t *testing.T, fake *fakeDB, rawQuery string, opts ListOptions) ([]pageRow, *Meta, error) {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(fake), SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger:                 logger.Discard,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/rows?"+rawQuery, nil)
+	var rows []pageRow
+	meta, err := Paginate(c, db, opts, &rows)
+	return rows, meta, err
+}
+
+func cursorOf(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func TestPaginateCursorIgnoresDefaultSort(t *testing.T) {
+	fake := &fakeDB{total: 5, ids: []int64{9, 8, 7}}
+	opts := ListOptions{Sortable: map[string]string{"created_at": "created_at"}, DefaultSort: "-created_at"}
+	rows, meta, err := paginateWith(t, fake, "cursor=&per_page=2", opts)
+	if err != nil {
+		t.Fatalf("Paginate: %v", err)
+	}
+	if !strings.Contains(fake.query, "ORDER BY id DESC LIMIT ?") || len(fake.args) != 1 || fake.args[0].Value != int64(3) {
+		t.Errorf("query = %q with %v, want newest first with one extra row", fake.query, fake.args)
+	}
+	if len(rows) != 2 || rows[1].ID != 8 {
+		t.Errorf("rows = %v, want ids 9 and 8", rows)
+	}
+	if meta.Total != 5 || meta.NextCursor != cursorOf("8") {
+		t.Errorf("meta = %+v, want total 5 and a cursor after 8", meta)
+	}
+	if !strings.Contains(meta.Next, "cursor="+meta.NextCursor) {
+		t.Errorf("next = %q, want a link carrying the cursor", meta.Next)
+	}
+}
+
+func TestPaginateCursorContinuesAfterCursor(t *testing.T) {
+	fake := &fakeDB{total: 5, ids: []int64{7, 6}}
+	_, meta, err := paginateWith(t, fake, "cursor="+cursorOf("8")+"&per_page=2", ListOptions{DefaultSort: "name"})
+	if err != nil {
+		t.Fatalf("Paginate: %v", err)
+	}
+	if !strings.Contains(fake.query, "WHERE id < ?") || len(fake.args) == 0 || fake.args[0].Value != int64(8) {
+		t.Errorf("query = %q with %v, want rows before id 8", fake.query, fake.args)
+	}
+	if meta.NextCursor != "" || meta.Next != "" {
+		t.Errorf("meta = %+v, want the last page", meta)
+	}
+}
+
+func TestPaginateCursorAscending(t *testing.T) {
+	fake := &fakeDB{total: 1, ids: []int64{3}}
+	_, _, err := paginateWith(t, fake, "cursor="+cursorOf("2")+"&sort=id", ListOptions{DefaultSort: "-created_at"})
+	if err != nil {
+		t.Fatalf("Paginate: %v", err)
+	}
+	if !strings.Contains(fake.query, "WHERE id > ?") || !strings.Contains(fake.query, "ORDER BY id LIMIT") {
+		t.Errorf("query = %q, want rows after id 2 in ascending order", fake.query)
+	}
+}
+
+func TestPaginateCursorRejectsOtherSorts(t *testing.T) {
+	opts := ListOptions{Sortable: map[string]string{"title": "title"}, DefaultSort: "-id"}
+	for _, query := range []string{"cursor=&sort=title", "cursor=&sort=-created_at"} {
+		_, _, err := paginateWith(t, &fakeDB{}, query, opts)
+		if QueryErrorStatus(err) != http.StatusBadRequest {
+			t.Errorf("%s: err = %v, want a 400 query error", query, err)
+		}
+	}
+}
+
+func TestPaginateCursorRejectsInvalidCursor(t *testing.T) {
+	_, _, err := paginateWith(t, &fakeDB{}, "cursor=not-a-cursor", ListOptions{})
+	if QueryErrorStatus(err) != http.StatusBadRequest {
+		t.Errorf("err = %v, want a 400 query error", err)
+	}
+}
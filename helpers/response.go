@@ -4,4 +4,5 @@ type Response struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	Meta    *Meta       `json:"meta,omitempty"`
 }
@@ -1,13 +1,82 @@
 package helpers
 
-import "gorm.io/gorm"
+import (
+	"html"
+	"regexp"
+	"strings"
 
-func Search(search, field string) func(db *gorm.DB) *gorm.DB {
+	"gorm.io/gorm"
+)
+
+// Search matches rows where any of fields contains search. An empty search matches everything.
+func Search(search string, fields ...string) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		if search != "" {
-			db = db.Where("%"+field+"% ? LIKE", "%"+search+"%")
-			//db = db.Or("description LIKE ?", "%"+search+"%")
+		if search == "" || len(fields) == 0 {
+			return db
+		}
+		clauses := make([]string, len(fields))
+		args := make([]interface{}, len(fields))
+		for i, field := range fields {
+			clauses[i] = field + " LIKE ?"
+			args[i] = "%" + search + "%"
 		}
-		return db
+		return db.Where("("+strings.Join(clauses, " OR ")+")", args...)
+	}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// StripTags returns the text of an HTML fragment with tags removed, entities decoded and whitespace collapsed.
+func StripTags(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTag.ReplaceAllString(s, " "))), " ")
+}
+
+// Highlight returns an HTML-escaped excerpt of text of about width characters around the
+// first occurrence of any of terms, with every term found at the start of a word wrapped in <mark>.
+// Markup in text is stripped first. It returns "" when no term occurs.
+func Highlight(text string, terms []string, width int) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	// a term counts at the start of a word only, so "cat" does not light up "concatenate"
+	re := regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(` + strings.Join(quoted, "|") + `)`)
+
+	plain := []rune(StripTags(text))
+	s := string(plain)
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return ""
+	}
+
+	// centre a window of width runes on the first match
+	first := len([]rune(s[:loc[2]]))
+	start := first - width/3
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(plain) {
+		end = len(plain)
+	}
+	window := string(plain[start:end])
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(window, -1) {
+		b.WriteString(html.EscapeString(window[last:m[2]]))
+		b.WriteString("<mark>" + html.EscapeString(window[m[2]:m[3]]) + "</mark>")
+		last = m[3]
+	}
+	b.WriteString(html.EscapeString(window[last:]))
+	if end < len(plain) {
+		b.WriteString("…")
 	}
+	return b.String()
 }
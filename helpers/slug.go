@@ -0,0 +1,112 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// transliterations covers letters that do not decompose into an ASCII base letter
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'å': "a", 'đ': "d", 'ð': "d", 'þ': "th", 'ł': "l", 'ı': "i", 'ŋ': "ng",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'ґ': "g", 'д': "d", 'е': "e", 'ё': "yo", 'є': "ye", 'ж': "zh", 'з': "z",
+	'и': "i", 'і': "i", 'ї': "yi", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l",
+	'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f",
+	'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+// Slugify turns s into a lower-case, hyphen-separated ASCII slug of at most maxLen bytes.
+// Accents are dropped and Cyrillic and Greek letters transliterated; other characters
+// become separators. The result is empty if nothing of s can be represented.
+func Slugify(s string, maxLen int) string {
+	var b strings.Builder
+	pendingDash := false
+	write := func(part string) {
+		if pendingDash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		pendingDash = false
+		b.WriteString(part)
+	}
+	for _, r := range strings.ToLower(s) {
+		// "й" is transliterated whole; otherwise NFKD splits "é" or "ή" into a base letter and an accent that is skipped
+		runes := []rune{r}
+		if _, ok := transliterations[r]; !ok {
+			runes = []rune(norm.NFKD.String(string(r)))
+		}
+		for _, d := range runes {
+			t, ok := transliterations[d]
+			switch {
+			case ok:
+				if t != "" {
+					write(t)
+				}
+			case d < unicode.MaxASCII && (unicode.IsLetter(d) || unicode.IsDigit(d)):
+				write(string(d))
+			case unicode.Is(unicode.Mn, d):
+			default:
+				pendingDash = true
+			}
+		}
+	}
+	return TruncateSlug(b.String(), maxLen)
+}
+
+// TruncateSlug shortens slug to at most maxLen bytes, cutting at a hyphen where possible.
+func TruncateSlug(slug string, maxLen int) string {
+	if len(slug) <= maxLen {
+		return slug
+	}
+	slug = slug[:maxLen]
+	if i := strings.LastIndexByte(slug, '-'); i > maxLen/2 {
+		slug = slug[:i]
+	}
+	return strings.Trim(slug, "-")
+}
+
+// UniqueSlug returns slug, or slug with the lowest free "-2", "-3", ... suffix, such that no row of
+// model other than exceptID uses it. Soft-deleted rows count since they still hold the unique index.
+func UniqueSlug(db *gorm.DB, model interface{}, slug string, exceptID uint, maxLen int) (string, error) {
+	var taken []string
+	err := db.Unscoped().Model(model).
+		Where("slug = ? OR slug LIKE ?", slug, slug+"-%").
+		Where("id <> ?", exceptID).
+		Pluck("slug", &taken).Error
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool, len(taken))
+	for _, t := range taken {
+		used[t] = true
+	}
+	for n := 1; ; n++ {
+		candidate := slug
+		if n > 1 {
+			suffix := "-" + strconv.Itoa(n)
+			candidate = TruncateSlug(slug, maxLen-len(suffix)) + suffix
+		}
+		if used[candidate] {
+			continue
+		}
+		if strings.HasPrefix(candidate, slug) {
+			return candidate, nil
+		}
+		// a shortened slug was not covered by the query above
+		var count int64
+		if err := db.Unscoped().Model(model).Where("slug = ? AND id <> ?", candidate, exceptID).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		used[candidate] = true
+	}
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"beres/infra/database"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Cache keeps values in process memory for TTL. Each app instance caches separately.
+// It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]entry
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// Tags caches the tag list used by autocomplete and the tag clouds. It is flushed whenever
+// posts, tags or their links are written, see Setup.
+var Tags = New(5 * time.Minute)
+
+func New(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, entries: map[string]entry{}}
+}
+
+// Setup configures the caches from *_CACHE_SECONDS settings and hooks their invalidation into db.
+func Setup(db *gorm.DB) error {
+	viper.SetDefault("TAG_CACHE_SECONDS", 300)
+
+	Tags.mu.Lock()
+	Tags.ttl = time.Duration(viper.GetInt("TAG_CACHE_SECONDS")) * time.Second
+	Tags.mu.Unlock()
+	return Tags.FlushOnWrite(db, "cache:tags", "posts", "tags", "posts_tags")
+}
+
+// Get returns the value cached for key, if it has not expired.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set caches value for key. A TTL of 0 disables the cache.
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	c.entries[key] = entry{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+// Flush drops every cached value.
+func (c *Cache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]entry{}
+}
+
+// FlushOnWrite registers GORM callbacks, called name, that flush c after every create, update
+// or delete through db on one of tables. Inside a transaction c is flushed again once it commits,
+// dropping what a reader cached from the old rows in between. Writes made with Exec are not seen.
+func (c *Cache) FlushOnWrite(db *gorm.DB, name string, tables ...string) error {
+	watched := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		watched[t] = true
+	}
+	flush := func(tx *gorm.DB) {
+		if watched[tx.Statement.Table] {
+			c.Flush()
+			database.AfterCommit(tx, c.Flush)
+		}
+	}
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register(name, flush); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register(name, flush); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register(name, flush)
+}
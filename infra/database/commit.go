@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// committingPool is the connection pool behind DB. Its transactions run the functions queued
+// with AfterCommit once they commit.
+type committingPool struct {
+	*sql.DB
+}
+
+func (p committingPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := p.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &committingTx{Tx: tx}, nil
+}
+
+// GetDBConn lets gorm.DB.DB() reach the pool.
+func (p committingPool) GetDBConn() (*sql.DB, error) {
+	return p.DB, nil
+}
+
+type committingTx struct {
+	*sql.Tx
+	mu    sync.Mutex
+	after []func()
+}
+
+func (t *committingTx) Commit() error {
+	if err := t.Tx.Commit(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	after := t.after
+	t.after = nil
+	t.mu.Unlock()
+	for _, fn := range after {
+		fn()
+	}
+	return nil
+}
+
+// AfterCommit runs fn once the transaction tx belongs to has committed, and drops it if the
+// transaction rolls back. Outside a transaction fn runs right away.
+func AfterCommit(tx *gorm.DB, fn func()) {
+	t, ok := tx.Statement.ConnPool.(*committingTx)
+	if !ok {
+		fn()
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.after = append(t.after, fn)
+}
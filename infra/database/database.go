@@ -1,6 +1,7 @@
 package database
 
 import (
+	"database/sql"
 	"log"
 
 	"github.com/spf13/viper"
@@ -19,8 +20,15 @@ func DbConnection(dsn string) error {
 		logLevel = logger.Info
 	}
 
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+	sqlDB, err := sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatalf("failed to connect database: %v", err)
+		return err
+	}
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: dsn, Conn: committingPool{sqlDB}}), &gorm.Config{
 		Logger: logger.Default.LogMode(logLevel),
+		// report unique violations as gorm.ErrDuplicatedKey
+		TranslateError: true,
 	})
 	if err != nil {
 		log.Fatalf("failed to connect database: %v", err)
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var Default Mailer = &LogMailer{}
+
+// Setup selects the mailer from MAIL_DRIVER ("smtp" or "log").
+func Setup() error {
+	viper.SetDefault("MAIL_DRIVER", "log")
+	viper.SetDefault("MAIL_FROM", "no-reply@localhost")
+	viper.SetDefault("SMTP_PORT", "587")
+
+	switch driver := viper.GetString("MAIL_DRIVER"); driver {
+	case "smtp":
+		Default = &SMTPMailer{
+			Host:     viper.GetString("SMTP_HOST"),
+			Port:     viper.GetString("SMTP_PORT"),
+			Username: viper.GetString("SMTP_USERNAME"),
+			Password: viper.GetString("SMTP_PASSWORD"),
+			From:     viper.GetString("MAIL_FROM"),
+		}
+	case "log":
+		Default = &LogMailer{Path: viper.GetString("MAIL_LOG_FILE")}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+	return nil
+}
+
+// Send delivers msg through the configured mailer.
+func Send(msg Message) error {
+	return Default.Send(msg)
+}
@@ -0,0 +1,159 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Field is a piece of a document's text. Terms found in it count Weight (at least 1) times.
+// Terms of a Restricted field only count for searches that reveal the document.
+type Field struct {
+	Text       string
+	Weight     float64
+	Restricted bool
+}
+
+// Hit is a matching document and its relevance.
+type Hit struct {
+	ID    uint
+	Score float64
+}
+
+// Index is an in-memory inverted index ranking documents by weighted TF-IDF.
+// It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[uint]frequency // term -> document -> weighted term frequency
+	terms    map[uint][]string             // document -> its distinct terms, for removal
+}
+
+// frequency splits a term's weighted frequency between open and restricted fields.
+type frequency struct {
+	open, restricted float64
+}
+
+func NewIndex() *Index {
+	return &Index{postings: map[string]map[uint]frequency{}, terms: map[uint][]string{}}
+}
+
+// Put indexes document id, replacing whatever was indexed for it before.
+func (ix *Index) Put(id uint, fields ...Field) {
+	freq := map[string]frequency{}
+	for _, f := range fields {
+		for _, term := range Tokenize(f.Text) {
+			tf := freq[term]
+			if f.Restricted {
+				tf.restricted += f.Weight
+			} else {
+				tf.open += f.Weight
+			}
+			freq[term] = tf
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+	terms := make([]string, 0, len(freq))
+	for term, tf := range freq {
+		docs := ix.postings[term]
+		if docs == nil {
+			docs = map[uint]frequency{}
+			ix.postings[term] = docs
+		}
+		docs[id] = tf
+		terms = append(terms, term)
+	}
+	ix.terms[id] = terms
+}
+
+// Remove drops document id from the index.
+func (ix *Index) Remove(id uint) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id uint) {
+	for _, term := range ix.terms[id] {
+		docs := ix.postings[term]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.terms, id)
+}
+
+// Len returns the number of indexed documents.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.terms)
+}
+
+// Search returns the documents containing any term of query, best first. Restricted fields
+// count only for the documents reveal accepts; a nil reveal accepts every document.
+func (ix *Index) Search(query string, reveal func(id uint) bool) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	n := float64(len(ix.terms))
+	scores := map[uint]float64{}
+	seen := map[string]bool{}
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		// hidden text must not sway the ranking either, so it is left out of the document frequency too
+		matches := map[uint]float64{}
+		for id, f := range ix.postings[term] {
+			tf := f.open
+			if f.restricted > 0 && (reveal == nil || reveal(id)) {
+				tf += f.restricted
+			}
+			if tf > 0 {
+				matches[id] = tf
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		idf := math.Log(1 + n/float64(len(matches)))
+		for id, tf := range matches {
+			// dampen repeated terms so one word spammed in the content cannot dominate
+			scores[id] += (1 + math.Log(tf)) * idf
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID > hits[j].ID
+	})
+	return hits
+}
+
+// Tokenize lower-cases s and splits it into words of letters and digits.
+// Single-character words are dropped.
+func Tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms := words[:0]
+	for _, w := range words {
+		if len([]rune(w)) > 1 {
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
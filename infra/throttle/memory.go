@@ -0,0 +1,53 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many updates pass between purges of stale entries
+const sweepEvery = 1000
+
+// MemoryStore keeps entries in process memory. Each app instance counts separately.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	updates int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]Entry{}}
+}
+
+func (s *MemoryStore) Get(key string) Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key]
+}
+
+func (s *MemoryStore) Update(key string, fn func(Entry) Entry) Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := fn(s.entries[key])
+	s.entries[key] = e
+	if s.updates++; s.updates%sweepEvery == 0 {
+		s.sweep()
+	}
+	return e
+}
+
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// sweep drops entries that are unlocked and have not failed for a day
+func (s *MemoryStore) sweep() {
+	now := time.Now()
+	for k, e := range s.entries {
+		if now.After(e.LockedUntil) && now.Sub(e.LastFailure) > 24*time.Hour {
+			delete(s.entries, k)
+		}
+	}
+}
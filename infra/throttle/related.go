@@ -0,0 +1,65 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Related remembers, per key, other keys that failed together with it, such as the client IPs
+// that failed logins for an email, so that whoever lifts one lockout can see the others.
+// Keys are forgotten after Keep without a new failure.
+type Related struct {
+	mu      sync.Mutex
+	Keep    time.Duration
+	keys    map[string]map[string]time.Time
+	updates int
+}
+
+// LoginIPsByEmail records the client IPs behind failed logins for each normalized email.
+var LoginIPsByEmail = NewRelated(2 * time.Hour)
+
+func NewRelated(keep time.Duration) *Related {
+	return &Related{Keep: keep, keys: map[string]map[string]time.Time{}}
+}
+
+// Add records that other failed together with key.
+func (r *Related) Add(key, other string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.keys[key] == nil {
+		r.keys[key] = map[string]time.Time{}
+	}
+	r.keys[key][other] = now
+	if r.updates++; r.updates%sweepEvery == 0 {
+		r.sweep(now)
+	}
+}
+
+// Get returns the keys recorded for key within Keep.
+func (r *Related) Get(key string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var keys []string
+	for k, seen := range r.keys[key] {
+		if now.Sub(seen) <= r.Keep {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// sweep drops the keys not seen within Keep
+func (r *Related) sweep(now time.Time) {
+	for key, others := range r.keys {
+		for k, seen := range others {
+			if now.Sub(seen) > r.Keep {
+				delete(others, k)
+			}
+		}
+		if len(others) == 0 {
+			delete(r.keys, key)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package throttle
+
+import (
+	"math"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Entry is the failure record kept for one key.
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists entries. Update must apply fn atomically for a key.
+type Store interface {
+	Get(key string) Entry
+	Update(key string, fn func(Entry) Entry) Entry
+	Delete(key string)
+}
+
+// Limiter locks a key out with exponential backoff once it reaches MaxAttempts failures.
+// Failures are forgotten after Window without a new one.
+type Limiter struct {
+	Store       Store
+	MaxAttempts int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	Window      time.Duration
+}
+
+// Login limiters, keyed by normalized email and by client IP.
+// The IP limit is looser because many users can share one address.
+var (
+	LoginEmail = &Limiter{Store: NewMemoryStore(), MaxAttempts: 5, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: 15 * time.Minute}
+	LoginIP    = &Limiter{Store: NewMemoryStore(), MaxAttempts: 20, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: 15 * time.Minute}
+)
+
+// Mail limiters count the password reset and verification mails requested, keyed by normalized
+// email and by client IP, so that neither an inbox nor the mail server can be flooded.
+var (
+	MailEmail = &Limiter{Store: NewMemoryStore(), MaxAttempts: 3, BaseLockout: 5 * time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+	MailIP    = &Limiter{Store: NewMemoryStore(), MaxAttempts: 10, BaseLockout: 5 * time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+)
+
+// Setup configures the login limiters from LOGIN_* settings and the mail limiters from MAIL_* settings.
+func Setup() {
+	viper.SetDefault("LOGIN_MAX_ATTEMPTS", 5)
+	viper.SetDefault("LOGIN_MAX_ATTEMPTS_PER_IP", 20)
+	viper.SetDefault("LOGIN_LOCKOUT_SECONDS", 60)
+	viper.SetDefault("LOGIN_MAX_LOCKOUT_SECONDS", 3600)
+	viper.SetDefault("LOGIN_ATTEMPT_WINDOW_SECONDS", 900)
+
+	base := time.Duration(viper.GetInt("LOGIN_LOCKOUT_SECONDS")) * time.Second
+	max := time.Duration(viper.GetInt("LOGIN_MAX_LOCKOUT_SECONDS")) * time.Second
+	window := time.Duration(viper.GetInt("LOGIN_ATTEMPT_WINDOW_SECONDS")) * time.Second
+	LoginEmail = &Limiter{Store: LoginEmail.Store, MaxAttempts: viper.GetInt("LOGIN_MAX_ATTEMPTS"), BaseLockout: base, MaxLockout: max, Window: window}
+	LoginIP = &Limiter{Store: LoginIP.Store, MaxAttempts: viper.GetInt("LOGIN_MAX_ATTEMPTS_PER_IP"), BaseLockout: base, MaxLockout: max, Window: window}
+	// an IP can stay locked for up to max after its last failure, and count failures for window after that
+	LoginIPsByEmail.mu.Lock()
+	LoginIPsByEmail.Keep = max + window
+	LoginIPsByEmail.mu.Unlock()
+
+	viper.SetDefault("MAIL_MAX_PER_EMAIL", 3)
+	viper.SetDefault("MAIL_MAX_PER_IP", 10)
+	viper.SetDefault("MAIL_LOCKOUT_SECONDS", 300)
+	viper.SetDefault("MAIL_MAX_LOCKOUT_SECONDS", 3600)
+	viper.SetDefault("MAIL_WINDOW_SECONDS", 3600)
+
+	base = time.Duration(viper.GetInt("MAIL_LOCKOUT_SECONDS")) * time.Second
+	max = time.Duration(viper.GetInt("MAIL_MAX_LOCKOUT_SECONDS")) * time.Second
+	window = time.Duration(viper.GetInt("MAIL_WINDOW_SECONDS")) * time.Second
+	MailEmail = &Limiter{Store: MailEmail.Store, MaxAttempts: viper.GetInt("MAIL_MAX_PER_EMAIL"), BaseLockout: base, MaxLockout: max, Window: window}
+	MailIP = &Limiter{Store: MailIP.Store, MaxAttempts: viper.GetInt("MAIL_MAX_PER_IP"), BaseLockout: base, MaxLockout: max, Window: window}
+}
+
+// RetryAfter returns how long key stays locked, or 0 if it may try now.
+func (l *Limiter) RetryAfter(key string) time.Duration {
+	if wait := time.Until(l.Store.Get(key).LockedUntil); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Fail records a failure for key and returns the resulting lockout, or 0 if not locked.
+func (l *Limiter) Fail(key string) time.Duration {
+	now := time.Now()
+	e := l.Store.Update(key, func(e Entry) Entry {
+		if now.Sub(e.LastFailure) > l.Window && now.After(e.LockedUntil) {
+			e = Entry{}
+		}
+		e.Failures++
+		e.LastFailure = now
+		if over := e.Failures - l.MaxAttempts; over >= 0 {
+			e.LockedUntil = now.Add(l.lockout(over))
+		}
+		return e
+	})
+	if wait := e.LockedUntil.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Reset forgets every failure for key, lifting any lockout.
+func (l *Limiter) Reset(key string) {
+	l.Store.Delete(key)
+}
+
+// lockout doubles BaseLockout for every failure past the limit, capped at MaxLockout
+func (l *Limiter) lockout(over int) time.Duration {
+	d := float64(l.BaseLockout) * math.Pow(2, float64(over))
+	if d > float64(l.MaxLockout) {
+		return l.MaxLockout
+	}
+	return time.Duration(d)
+}
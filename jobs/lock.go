@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"database/sql"
+
+	"beres/infra/database"
+
+	"gorm.io/gorm"
+)
+
+// withLock runs fn on a single connection while holding the MySQL named lock name, so only
+// one app instance does the work. It reports false without running fn when another instance
+// holds the lock. Other databases have no named locks and always run fn.
+func withLock(name string, fn func(conn *gorm.DB) error) (bool, error) {
+	if database.DB.Dialector.Name() != "mysql" {
+		return true, fn(database.DB)
+	}
+	ran := false
+	// named locks belong to a connection, so acquire, work and release on the same one
+	err := database.DB.Connection(func(conn *gorm.DB) error {
+		var got sql.NullInt64
+		if err := conn.Raw("SELECT GET_LOCK(?, 0)", name).Row().Scan(&got); err != nil {
+			return err
+		}
+		if got.Int64 != 1 {
+			return nil
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", name)
+		ran = true
+		return fn(conn)
+	})
+	return ran, err
+}
@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"encoding/json"
+	"time"
+
+	"beres/helpers"
+	"beres/infra/logger"
+	"beres/models"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const schedulerLock = "beres.post_scheduler"
+
+// StartScheduler publishes and unpublishes posts whose time has come, checking every
+// SCHEDULER_INTERVAL_SECONDS in the background.
+func StartScheduler() {
+	viper.SetDefault("SCHEDULER_INTERVAL_SECONDS", 30)
+	interval := time.Duration(viper.GetInt("SCHEDULER_INTERVAL_SECONDS")) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := withLock(schedulerLock, runSchedule); err != nil {
+				logger.Errorf("post scheduler failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func runSchedule(conn *gorm.DB) error {
+	now := time.Now()
+	if err := flipPosts(conn, "scheduled_publish", "publish_at", now, models.PostStatusScheduled, models.PostStatusPublish); err != nil {
+		return err
+	}
+	return flipPosts(conn, "scheduled_unpublish", "unpublish_at", now, models.PostStatusPublish, models.PostStatusDraft)
+}
+
+// flipPosts moves posts in status from whose column time has passed into status to, auditing and
+// recording the transition of each as action
+func flipPosts(conn *gorm.DB, action, column string, now time.Time, from, to string) error {
+	var ids []uint
+	if err := conn.Model(&models.Post{}).Where("status = ? AND "+column+" <= ?", from, now).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	updates := map[string]interface{}{"status": to, "version": gorm.Expr("version + 1")}
+	if err := conn.Model(&models.Post{}).Where("id IN ? AND status = ?", ids, from).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	changes, _ := json.Marshal(map[string]helpers.Change{"status": {From: from, To: to}})
+	entries := make([]models.AuditLog, len(ids))
+	for i, id := range ids {
+		entries[i] = models.AuditLog{Action: action, EntityType: "post", EntityID: id, Changes: changes}
+	}
+	if err := conn.Create(&entries).Error; err != nil {
+		logger.Errorf("auditing scheduled posts failed: %v", err)
+	}
+	transitions := make([]models.PostTransition, len(ids))
+	for i, id := range ids {
+		transitions[i] = models.PostTransition{PostID: id, Action: action, FromStatus: from, ToStatus: to}
+	}
+	if err := conn.Create(&transitions).Error; err != nil {
+		logger.Errorf("recording scheduled post transitions failed: %v", err)
+	}
+	logger.Infof("post scheduler moved %d posts from %s to %s", len(ids), from, to)
+	return nil
+}
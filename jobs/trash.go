@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"time"
+
+	"beres/infra/logger"
+	"beres/models"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const (
+	trashPurgeLock     = "beres.trash_purge"
+	trashPurgeInterval = time.Hour
+	trashPurgeBatch    = 500
+)
+
+// StartTrashPurge permanently deletes content that has been in the trash for more than
+// TRASH_RETENTION_DAYS, checking every hour in the background. A retention of 0 keeps it forever.
+func StartTrashPurge() {
+	viper.SetDefault("TRASH_RETENTION_DAYS", 30)
+	days := viper.GetInt("TRASH_RETENTION_DAYS")
+	if days <= 0 {
+		logger.Infof("trash retention is off, trashed content is kept until purged")
+		return
+	}
+	retention := time.Duration(days) * 24 * time.Hour
+
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			cutoff := time.Now().Add(-retention)
+			if _, err := withLock(trashPurgeLock, func(conn *gorm.DB) error { return purgeTrash(conn, cutoff) }); err != nil {
+				logger.Errorf("trash purge failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func purgeTrash(conn *gorm.DB, cutoff time.Time) error {
+	for _, t := range models.Trashables {
+		for {
+			var ids []uint
+			err := conn.Unscoped().Model(t.Model).Where("deleted_at < ?", cutoff).Limit(trashPurgeBatch).Pluck("id", &ids).Error
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				break
+			}
+			if err := conn.Transaction(func(tx *gorm.DB) error { return t.Purge(tx, ids) }); err != nil {
+				return err
+			}
+
+			entries := make([]models.AuditLog, len(ids))
+			for i, id := range ids {
+				entries[i] = models.AuditLog{Action: models.AuditPurge, EntityType: t.Entity, EntityID: id}
+			}
+			if err := conn.Create(&entries).Error; err != nil {
+				logger.Errorf("auditing purged %s rows failed: %v", t.Entity, err)
+			}
+			logger.Infof("trash purge deleted %d %s rows", len(ids), t.Entity)
+		}
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"beres/config"
+	"beres/infra/cache"
 	"beres/infra/database"
 	"beres/infra/logger"
+	"beres/infra/mailer"
+	"beres/infra/throttle"
+	"beres/jobs"
 	"beres/migrations"
 	"beres/routers"
 	"time"
@@ -27,7 +31,19 @@ func main() {
 		logger.Fatalf("database DbConnection error: %s", err)
 	}
 
+	if err := mailer.Setup(); err != nil {
+		logger.Fatalf("mailer Setup() error: %s", err)
+	}
+
+	throttle.Setup()
+	if err := cache.Setup(database.DB); err != nil {
+		logger.Fatalf("cache Setup() error: %s", err)
+	}
+
 	migrations.Migrate()
+	migrations.SeedAdmin()
+	jobs.StartScheduler()
+	jobs.StartTrashPurge()
 	router := routers.SetupRoute()
 	logger.Fatalf("%v", router.Run(config.ServerConfig()))
 }
@@ -1,7 +1,10 @@
 package migrations
 
 import (
+	"strings"
+
 	"beres/infra/database"
+	"beres/infra/logger"
 	"beres/models"
 )
 
@@ -19,9 +22,82 @@ func Migrate() {
 		&models.Widget{},
 		&models.PersonalAccessToken{},
 		&models.Section{},
+		&models.VerificationToken{},
+		&models.TwoFactorRecoveryCode{},
+		&models.RefreshToken{},
+		&models.AuditLog{},
+		&models.PostRevision{},
+		&models.SlugRedirect{},
+		&models.PostTransition{},
 	}
+
+	migrator := database.DB.Migrator()
+	hadRole := migrator.HasColumn(&models.User{}, "role")
+	hadEmailVerifiedAt := migrator.HasColumn(&models.User{}, "email_verified_at")
+
 	err := database.DB.AutoMigrate(migrationModels...)
 	if err != nil {
+		logger.Errorf("migration failed: %v", err)
 		return
 	}
+
+	// accounts created before roles existed could all write content: they become editors,
+	// and the oldest one stays in charge as admin
+	if !hadRole && migrator.HasTable(&models.User{}) {
+		database.DB.Exec("UPDATE users SET role = ?", models.RoleEditor)
+		database.DB.Exec("UPDATE users SET role = ? ORDER BY id LIMIT 1", models.RoleAdmin)
+	}
+	// accounts created before email verification existed are trusted as-is
+	if !hadEmailVerifiedAt {
+		database.DB.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL")
+	}
+	// the "trash" status predates soft deletes; such posts move to the trash as drafts
+	database.DB.Exec("UPDATE posts SET status = ?, deleted_at = COALESCE(deleted_at, updated_at) WHERE status = 'trash'", models.PostStatusDraft)
+	refreshPostStatusCheck()
+	// post search runs on FULLTEXT indexes where MySQL provides them and falls back to an in-memory index otherwise
+	if database.DB.Dialector.Name() == "mysql" {
+		for _, idx := range models.SearchIndexes {
+			if migrator.HasIndex(idx.Model, idx.Name) {
+				continue
+			}
+			if err := database.DB.Exec("CREATE FULLTEXT INDEX " + idx.Name + " ON " + idx.Table + " (" + idx.Columns + ")").Error; err != nil {
+				logger.Errorf("creating search index %s failed: %v", idx.Name, err)
+			}
+		}
+	}
+}
+
+// retiredPostStatuses were once allowed by the check constraint on posts.status
+var retiredPostStatuses = []string{"trash"}
+
+// refreshPostStatusCheck recreates the check constraint on posts.status when it lacks a status
+// in models.PostStatuses or still allows a retired one; AutoMigrate only creates constraints that are missing.
+func refreshPostStatusCheck() {
+	const name = "chk_posts_status"
+	migrator := database.DB.Migrator()
+	if database.DB.Dialector.Name() != "mysql" || !migrator.HasConstraint(&models.Post{}, name) {
+		return
+	}
+	var clause string
+	row := database.DB.Raw("SELECT CHECK_CLAUSE FROM information_schema.CHECK_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND CONSTRAINT_NAME = ?", name).Row()
+	if err := row.Scan(&clause); err != nil {
+		return
+	}
+	current := true
+	for _, status := range models.PostStatuses {
+		current = current && strings.Contains(clause, "'"+status+"'")
+	}
+	for _, status := range retiredPostStatuses {
+		current = current && !strings.Contains(clause, "'"+status+"'")
+	}
+	if current {
+		return
+	}
+	if err := migrator.DropConstraint(&models.Post{}, name); err != nil {
+		logger.Errorf("dropping %s failed: %v", name, err)
+		return
+	}
+	if err := migrator.CreateConstraint(&models.Post{}, name); err != nil {
+		logger.Errorf("creating %s failed: %v", name, err)
+	}
 }
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"beres/infra/database"
+	"beres/infra/logger"
+	"beres/models"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeedAdmin makes the account ADMIN_EMAIL an admin, creating it with ADMIN_PASSWORD if it does
+// not exist yet. Public registration never grants admin, so this is how a site gets its first one.
+func SeedAdmin() {
+	email := strings.TrimSpace(viper.GetString("ADMIN_EMAIL"))
+	if email == "" {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("email = ?", email).First(&user).Error
+		if err == nil {
+			if user.Role == models.RoleAdmin {
+				return nil
+			}
+			return tx.Model(&user).Update("role", models.RoleAdmin).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		password := viper.GetString("ADMIN_PASSWORD")
+		if len(password) < 8 {
+			return errors.New("no such account; set ADMIN_PASSWORD (8 characters or more) to create it")
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Create(&models.User{Name: "Admin", Email: email, PasswordHash: string(hash), Role: models.RoleAdmin, EmailVerifiedAt: &now}).Error
+	})
+	if err != nil {
+		logger.Errorf("seeding admin %s failed: %v", email, err)
+		return
+	}
+	logger.Infof("%s is an admin", email)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Audit actions for the common write operations; other actions (e.g. "deactivate") are free-form.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+
+	AuditRestore = "restore" // brought back from the trash
+	AuditPurge   = "purge"   // deleted from the trash for good
+)
+
+// AuditLog records who changed what. Before/After are JSON snapshots of the entity and
+// Changes holds only the top-level fields that differ between them.
+type AuditLog struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	UserID     *uint          `gorm:"index" json:"user_id"`
+	Action     string         `gorm:"size:30;index;not null" json:"action"`
+	EntityType string         `gorm:"size:50;index:idx_audit_entity;not null" json:"entity_type"`
+	EntityID   uint           `gorm:"index:idx_audit_entity" json:"entity_id"`
+	Before     datatypes.JSON `gorm:"type:json" json:"before"`
+	After      datatypes.JSON `gorm:"type:json" json:"after"`
+	Changes    datatypes.JSON `gorm:"type:json" json:"changes"`
+	IP         string         `gorm:"size:45" json:"ip"`
+	UserAgent  string         `gorm:"size:255" json:"user_agent"`
+	CreatedAt  time.Time      `gorm:"index" json:"created_at"`
+}
+
+// TableName is Database TableName of this model
+func (e *AuditLog) TableName() string {
+	return "audit_logs"
+}
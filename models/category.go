@@ -4,6 +4,7 @@ import "gorm.io/gorm"
 
 type Category struct {
 	gorm.Model
+	Versioned
 	Name        string     `gorm:"size:50"`
 	Slug        string     `gorm:"size:50;uniqueIndex"`
 	Description string     `gorm:"size:500"`
@@ -4,6 +4,7 @@ import "gorm.io/gorm"
 
 type Menu struct {
 	gorm.Model
+	Versioned
 	Name     string `gorm:"size:50"`
 	Location string `gorm:"size:50;uniqueIndex"`
 	Items    []MenuItem
@@ -11,6 +12,7 @@ type Menu struct {
 
 type MenuItem struct {
 	gorm.Model
+	Versioned
 	MenuID   uint       `gorm:"index"`
 	ParentID *uint      `gorm:"index"`
 	Title    string     `gorm:"size:100"`
@@ -12,11 +12,27 @@ type PersonalAccessToken struct {
 	Abilities  string     `gorm:"type:text" json:"abilities"`
 	LastUsedAt *time.Time `gorm:"default:NULL" json:"last_used_at,omitempty"`
 	ExpiresAt  *time.Time `gorm:"default:NULL" json:"expires_at,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	// IdleTimeout in seconds since LastUsedAt after which the token stops working; 0 disables it
+	IdleTimeout int       `gorm:"default:0" json:"idle_timeout"`
+	FamilyID    string    `gorm:"size:64;index" json:"-"` // refresh token family of a login session
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // TableName is Database TableName of this model
 func (e *PersonalAccessToken) TableName() string {
 	return "personal_access_token"
 }
+
+// Expired reports whether the token is past its absolute lifetime or has been idle too long.
+func (e *PersonalAccessToken) Expired(now time.Time) bool {
+	if e.ExpiresAt != nil && e.ExpiresAt.Before(now) {
+		return true
+	}
+	return e.IdleTimeout > 0 && e.LastUsedAt != nil && now.Sub(*e.LastUsedAt) > time.Duration(e.IdleTimeout)*time.Second
+}
+
+// Can reports whether the token was issued with ability.
+func (e *PersonalAccessToken) Can(ability string) bool {
+	return hasAbility(ParseAbilities(e.Abilities), ability)
+}
@@ -1,17 +1,52 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Post statuses. A scheduled post goes live at PublishAt; a published one with an
+// UnpublishAt drops back to draft at that time. Private posts are only shown to their
+// author and to editors. Pending review and approved posts are moving through the
+// editorial workflow, see PostWorkflow. Deleted posts keep their status while in the trash.
+const (
+	PostStatusDraft         = "draft"
+	PostStatusPendingReview = "pending_review"
+	PostStatusApproved      = "approved"
+	PostStatusPublish       = "publish"
+	PostStatusScheduled     = "scheduled"
+	PostStatusPrivate       = "private"
+)
+
+// PostStatuses lists every status allowed by the check constraint on Post.Status.
+var PostStatuses = []string{
+	PostStatusDraft, PostStatusPendingReview, PostStatusApproved,
+	PostStatusPublish, PostStatusScheduled, PostStatusPrivate,
+}
 
 type Post struct {
 	gorm.Model
+	Versioned
 	Title         string     `gorm:"size:255"`
 	Slug          string     `gorm:"size:255;uniqueIndex"`
 	Content       string     `gorm:"type:longtext"`
 	Excerpt       string     `gorm:"size:500"`
 	AuthorID      uint       `gorm:"index"`
 	Author        User       `gorm:"foreignKey:AuthorID"`
-	Status        string     `gorm:"size:20;default:'draft';check:status IN ('draft', 'publish', 'trash')"`
+	Status        string     `gorm:"size:20;default:'draft';check:status IN ('draft', 'pending_review', 'approved', 'publish', 'scheduled', 'private')"`
+	PublishAt     *time.Time `gorm:"index"`
+	UnpublishAt   *time.Time `gorm:"index"`
 	FeaturedImage string     `gorm:"size:255"`
-	Categories    []Category `gorm:"many2many:posts_categories;"`
-	Tags          []Tag      `gorm:"many2many:posts_tags;"`
+	// PasswordHash is set on password-protected posts, whose content is withheld from readers without the password
+	PasswordHash      string     `gorm:"size:255" json:"-"`
+	PasswordProtected bool       `gorm:"-"`
+	Categories        []Category `gorm:"many2many:posts_categories;"`
+	Tags              []Tag      `gorm:"many2many:posts_tags;"`
+}
+
+// AfterFind fills in PasswordProtected.
+func (e *Post) AfterFind(tx *gorm.DB) error {
+	e.PasswordProtected = e.PasswordHash != ""
+	return nil
 }
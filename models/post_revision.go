@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// PostRevision is a full snapshot of a post as saved by UserID at CreatedAt.
+// A nil UserID marks the baseline taken of a post that predates revision history.
+type PostRevision struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	PostID        uint           `gorm:"index;not null" json:"post_id"`
+	UserID        *uint          `gorm:"index" json:"user_id"`
+	Title         string         `gorm:"size:255" json:"title"`
+	Slug          string         `gorm:"size:255" json:"slug"`
+	Content       string         `gorm:"type:longtext" json:"content,omitempty"`
+	Excerpt       string         `gorm:"size:500" json:"excerpt"`
+	AuthorID      uint           `json:"author_id"`
+	Status        string         `gorm:"size:20" json:"status"`
+	FeaturedImage string         `gorm:"size:255" json:"featured_image"`
+	CategoryIDs   datatypes.JSON `gorm:"type:json" json:"category_ids"`
+	TagIDs        datatypes.JSON `gorm:"type:json" json:"tag_ids"`
+	CreatedAt     time.Time      `gorm:"index" json:"created_at"`
+}
+
+// TableName is Database TableName of this model
+func (e *PostRevision) TableName() string {
+	return "post_revisions"
+}
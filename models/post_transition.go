@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Editorial workflow actions: a draft is submitted for review, approved or rejected by a
+// reviewer, and published once approved. The author may withdraw a submission.
+const (
+	WorkflowSubmit   = "submit"
+	WorkflowWithdraw = "withdraw"
+	WorkflowApprove  = "approve"
+	WorkflowReject   = "reject"
+	WorkflowPublish  = "publish"
+	// WorkflowResubmit is recorded, not taken: it marks an edit by a user who may not publish
+	// that sent an approved, published or scheduled post back to review
+	WorkflowResubmit = "resubmit"
+)
+
+// WorkflowStep is one transition of the editorial workflow.
+type WorkflowStep struct {
+	Action  string
+	From    []string // statuses the post may be in
+	To      string
+	Ability string // needed to take the step
+	// AnyPost lets Ability take the step on other authors' posts; otherwise that also needs posts:edit_others
+	AnyPost      bool
+	NoteRequired bool
+}
+
+// PostWorkflow lists the transitions of the editorial workflow:
+// draft → pending_review → approved → publish, with reject sending a post back to draft.
+var PostWorkflow = []WorkflowStep{
+	{Action: WorkflowSubmit, From: []string{PostStatusDraft}, To: PostStatusPendingReview, Ability: AbilityPostsEdit},
+	{Action: WorkflowWithdraw, From: []string{PostStatusPendingReview, PostStatusApproved}, To: PostStatusDraft, Ability: AbilityPostsEdit},
+	{Action: WorkflowApprove, From: []string{PostStatusPendingReview}, To: PostStatusApproved, Ability: AbilityPostsReview, AnyPost: true},
+	{Action: WorkflowReject, From: []string{PostStatusPendingReview, PostStatusApproved}, To: PostStatusDraft, Ability: AbilityPostsReview, AnyPost: true, NoteRequired: true},
+	{Action: WorkflowPublish, From: []string{PostStatusApproved}, To: PostStatusPublish, Ability: AbilityPostsPublish},
+}
+
+// FindWorkflowStep returns the step taking action on a post in status from.
+func FindWorkflowStep(action, from string) (WorkflowStep, bool) {
+	for _, step := range PostWorkflow {
+		if step.Action != action {
+			continue
+		}
+		for _, f := range step.From {
+			if f == from {
+				return step, true
+			}
+		}
+	}
+	return WorkflowStep{}, false
+}
+
+// PostTransition records a change of a post's status by UserID, with an optional note
+// such as a reviewer's reason for rejecting it. A nil UserID marks a change made by the scheduler.
+type PostTransition struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	PostID     uint      `gorm:"index;not null" json:"post_id"`
+	UserID     *uint     `gorm:"index" json:"user_id"`
+	Action     string    `gorm:"size:30;not null" json:"action"`
+	FromStatus string    `gorm:"size:20" json:"from_status"`
+	ToStatus   string    `gorm:"size:20" json:"to_status"`
+	Note       string    `gorm:"type:text" json:"note"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName is Database TableName of this model
+func (e *PostTransition) TableName() string {
+	return "post_transitions"
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a single-use secret exchanged for a new access token. Every rotation stays in
+// the same family, so presenting an already used token revokes the whole session.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	FamilyID  string     `gorm:"size:64;index;not null" json:"-"`
+	TokenHash string     `gorm:"size:255;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"` // absolute end of the session, kept across rotations
+	UsedAt    *time.Time `gorm:"default:NULL" json:"used_at,omitempty"`
+	RevokedAt *time.Time `gorm:"default:NULL" json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName is Database TableName of this model
+func (e *RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
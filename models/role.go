@@ -0,0 +1,96 @@
+package models
+
+import "strings"
+
+// Roles a User can hold, from most to least privileged.
+const (
+	RoleAdmin       = "admin"
+	RoleEditor      = "editor"
+	RoleAuthor      = "author"
+	RoleContributor = "contributor"
+	RoleSubscriber  = "subscriber"
+)
+
+// Abilities checked by middleware.RequireAbility and the controllers.
+const (
+	AbilityAll = "*"
+
+	AbilityPostsCreate       = "posts:create"
+	AbilityPostsEdit         = "posts:edit"
+	AbilityPostsEditOthers   = "posts:edit_others"
+	AbilityPostsPublish      = "posts:publish"
+	AbilityPostsReview       = "posts:review"
+	AbilityPostsDelete       = "posts:delete"
+	AbilityPostsDeleteOthers = "posts:delete_others"
+
+	AbilityCategoriesWrite = "categories:write"
+	AbilityTagsWrite       = "tags:write"
+	AbilityMenusWrite      = "menus:write"
+	AbilityWidgetsWrite    = "widgets:write"
+	AbilitySettingsWrite   = "settings:write"
+	AbilitySectionsWrite   = "sections:write"
+
+	AbilityUsersManage = "users:manage"
+	AbilityAuditRead   = "audit:read"
+)
+
+// Abilities lists every ability that may be granted to a token.
+var Abilities = []string{
+	AbilityPostsCreate, AbilityPostsEdit, AbilityPostsEditOthers, AbilityPostsPublish,
+	AbilityPostsReview, AbilityPostsDelete, AbilityPostsDeleteOthers,
+	AbilityCategoriesWrite, AbilityTagsWrite, AbilityMenusWrite,
+	AbilityWidgetsWrite, AbilitySettingsWrite, AbilitySectionsWrite,
+	AbilityUsersManage, AbilityAuditRead,
+}
+
+// RoleAbilities is the permission matrix mapping each role to the abilities it grants.
+var RoleAbilities = map[string][]string{
+	RoleAdmin: {AbilityAll},
+	RoleEditor: {
+		AbilityPostsCreate, AbilityPostsEdit, AbilityPostsEditOthers, AbilityPostsPublish,
+		AbilityPostsReview, AbilityPostsDelete, AbilityPostsDeleteOthers,
+		AbilityCategoriesWrite, AbilityTagsWrite, AbilityMenusWrite,
+	},
+	RoleAuthor: {
+		AbilityPostsCreate, AbilityPostsEdit, AbilityPostsPublish, AbilityPostsDelete,
+		AbilityTagsWrite,
+	},
+	RoleContributor: {AbilityPostsCreate, AbilityPostsEdit},
+	RoleSubscriber:  {},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := RoleAbilities[role]
+	return ok
+}
+
+// ValidAbility reports whether ability is "*" or one of Abilities.
+func ValidAbility(ability string) bool {
+	return ability == AbilityAll || hasAbility(Abilities, ability)
+}
+
+// RoleCan reports whether role grants ability.
+func RoleCan(role, ability string) bool {
+	return hasAbility(RoleAbilities[role], ability)
+}
+
+// ParseAbilities splits a comma separated ability list as stored on PersonalAccessToken.
+func ParseAbilities(s string) []string {
+	var out []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func hasAbility(list []string, ability string) bool {
+	for _, a := range list {
+		if a == AbilityAll || a == ability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+package models
+
+// FullTextIndex is a MySQL FULLTEXT index backing post search.
+type FullTextIndex struct {
+	Model   interface{}
+	Table   string
+	Name    string
+	Columns string
+}
+
+// SearchIndexes are created by the migration on MySQL; /search uses them when all exist.
+var SearchIndexes = []FullTextIndex{
+	{Model: &Post{}, Table: "posts", Name: "ft_posts_search", Columns: "title, excerpt, content"},
+	{Model: &Post{}, Table: "posts", Name: "ft_posts_title", Columns: "title"}, // ranks protected posts the caller cannot read
+	{Model: &Tag{}, Table: "tags", Name: "ft_tags_name", Columns: "name"},
+	{Model: &Category{}, Table: "categories", Name: "ft_categories_name", Columns: "name"},
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type Section struct {
@@ -14,6 +15,7 @@ type Section struct {
 	DisplayOrder int            `gorm:"default:0;index" json:"display_order"`
 	IsActive     bool           `gorm:"default:true;index" json:"is_active"`
 	Details      datatypes.JSON `gorm:"type:json;not null" json:"details"`
+	Version      uint           `gorm:"not null;default:1" json:"version"` // see Versioned
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 }
@@ -22,6 +24,14 @@ func (e *Section) TableName() string {
 	return "sections"
 }
 
+// BeforeCreate starts the version count at 1.
+func (e *Section) BeforeCreate(tx *gorm.DB) error {
+	if e.Version == 0 {
+		e.Version = 1
+	}
+	return nil
+}
+
 /*
 type HeroSectionDetails struct {
 	Title      string `json:"title"`
@@ -4,6 +4,7 @@ import "gorm.io/gorm"
 
 type Setting struct {
 	gorm.Model
+	Versioned
 	Key   string `gorm:"size:50;uniqueIndex"`
 	Value string `gorm:"type:text"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// SlugRedirect remembers a slug a post, category or tag used to have, so links to it keep working.
+type SlugRedirect struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	EntityType string    `gorm:"size:20;uniqueIndex:idx_slug_redirect;not null" json:"entity_type"`
+	OldSlug    string    `gorm:"size:255;uniqueIndex:idx_slug_redirect;not null" json:"old_slug"`
+	EntityID   uint      `gorm:"index;not null" json:"entity_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName is Database TableName of this model
+func (e *SlugRedirect) TableName() string {
+	return "slug_redirects"
+}
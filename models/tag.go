@@ -4,6 +4,7 @@ import "gorm.io/gorm"
 
 type Tag struct {
 	gorm.Model
+	Versioned
 	Name        string `gorm:"size:50"`
 	Slug        string `gorm:"size:50;uniqueIndex"`
 	Description string `gorm:"size:500"`
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// Trashable is a kind of row whose deletes are soft: deleted rows sit in the trash, from where
+// they can be restored or purged for good.
+type Trashable struct {
+	Entity  string      // entity type in audit logs
+	Model   interface{} // pointer to a zero row
+	Ability string      // needed to see, restore and purge these rows
+	// dependents are statements, taking the purged IDs, that remove or detach what refers to the
+	// rows, or move the version of rows that include them
+	dependents []string
+}
+
+// Trashables maps the type names of the /trash routes to their kinds of row.
+var Trashables = map[string]Trashable{
+	"posts": {Entity: "post", Model: &Post{}, Ability: AbilityPostsDelete, dependents: []string{
+		"DELETE FROM posts_categories WHERE post_id IN ?",
+		"DELETE FROM posts_tags WHERE post_id IN ?",
+		"DELETE FROM post_revisions WHERE post_id IN ?",
+		"DELETE FROM post_transitions WHERE post_id IN ?",
+		"DELETE FROM slug_redirects WHERE entity_type = 'post' AND entity_id IN ?",
+	}},
+	"categories": {Entity: "category", Model: &Category{}, Ability: AbilityCategoriesWrite, dependents: []string{
+		"DELETE FROM posts_categories WHERE category_id IN ?",
+		"UPDATE categories SET parent_id = NULL, version = version + 1 WHERE parent_id IN ?",
+		"DELETE FROM slug_redirects WHERE entity_type = 'category' AND entity_id IN ?",
+	}},
+	"tags": {Entity: "tag", Model: &Tag{}, Ability: AbilityTagsWrite, dependents: []string{
+		"DELETE FROM posts_tags WHERE tag_id IN ?",
+		"DELETE FROM slug_redirects WHERE entity_type = 'tag' AND entity_id IN ?",
+	}},
+	"menus": {Entity: "menu", Model: &Menu{}, Ability: AbilityMenusWrite, dependents: []string{
+		"DELETE FROM menu_items WHERE menu_id IN ?",
+	}},
+	"menu-items": {Entity: "menu_item", Model: &MenuItem{}, Ability: AbilityMenusWrite, dependents: []string{
+		"UPDATE menus SET version = version + 1 WHERE id IN (SELECT menu_id FROM menu_items WHERE id IN ?)",
+		"UPDATE menu_items SET parent_id = NULL, version = version + 1 WHERE parent_id IN ?",
+	}},
+	"widgets":  {Entity: "widget", Model: &Widget{}, Ability: AbilityWidgetsWrite},
+	"settings": {Entity: "setting", Model: &Setting{}, Ability: AbilitySettingsWrite},
+}
+
+// NewRow returns a pointer to a new zero row.
+func (t Trashable) NewRow() interface{} {
+	return reflect.New(reflect.TypeOf(t.Model).Elem()).Interface()
+}
+
+// NewList returns a pointer to a new empty slice of rows.
+func (t Trashable) NewList() interface{} {
+	return reflect.New(reflect.SliceOf(reflect.TypeOf(t.Model).Elem())).Interface()
+}
+
+// Purge permanently deletes the trashed rows among ids and whatever depends on them.
+func (t Trashable) Purge(tx *gorm.DB, ids []uint) error {
+	var trashed []uint
+	if err := tx.Unscoped().Model(t.Model).Where("id IN ? AND deleted_at IS NOT NULL", ids).Pluck("id", &trashed).Error; err != nil {
+		return err
+	}
+	if len(trashed) == 0 {
+		return nil
+	}
+	for _, stmt := range t.dependents {
+		if err := tx.Exec(stmt, trashed).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Where("id IN ?", trashed).Delete(t.Model).Error
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// TwoFactorRecoveryCode is a single-use code that stands in for a TOTP code. Only its hash is stored.
+type TwoFactorRecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:255;not null" json:"-"`
+	UsedAt    *time.Time `gorm:"default:NULL" json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName is Database TableName of this model
+func (e *TwoFactorRecoveryCode) TableName() string {
+	return "two_factor_recovery_codes"
+}
@@ -5,15 +5,38 @@ import (
 )
 
 type User struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	Name         string    `gorm:"size:255;not null" json:"name"`
-	Email        string    `gorm:"size:255;unique;not null" json:"email"`
-	PasswordHash string    `gorm:"size:255;not null" json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Posts        []Post    `gorm:"foreignKey:AuthorID"`
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	Name            string     `gorm:"size:255;not null" json:"name"`
+	Email           string     `gorm:"size:255;unique;not null" json:"email"`
+	PasswordHash    string     `gorm:"size:255;not null" json:"-"`
+	Role            string     `gorm:"size:20;not null;default:'subscriber';index" json:"role"`
+	AvatarURL       string     `gorm:"size:255" json:"avatar_url"`
+	DeactivatedAt   *time.Time `gorm:"default:NULL;index" json:"deactivated_at"`
+	EmailVerifiedAt *time.Time `gorm:"default:NULL" json:"email_verified_at"`
+	// TwoFactorSecret is set on enrollment; two-factor is only enforced once TwoFactorConfirmedAt is set
+	TwoFactorSecret      string     `gorm:"size:64" json:"-"`
+	TwoFactorConfirmedAt *time.Time `gorm:"default:NULL" json:"two_factor_confirmed_at"`
+	TwoFactorLastCounter int64      `gorm:"default:0" json:"-"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	Posts                []Post     `gorm:"foreignKey:AuthorID"`
 }
 
 func (e *User) TableName() string {
 	return "users"
 }
+
+// Active reports whether the user may sign in.
+func (e *User) Active() bool {
+	return e.DeactivatedAt == nil
+}
+
+// TwoFactorEnabled reports whether login requires a TOTP code.
+func (e *User) TwoFactorEnabled() bool {
+	return e.TwoFactorConfirmedAt != nil
+}
+
+// Can reports whether the user's role grants ability.
+func (e *User) Can(ability string) bool {
+	return RoleCan(e.Role, ability)
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Purposes a VerificationToken can be issued for.
+const (
+	TokenPurposeEmailVerify   = "email_verify"
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeTwoFactor     = "two_factor_login"
+)
+
+// VerificationToken is a single-use secret mailed to a user. Only its hash is stored.
+type VerificationToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	Purpose   string     `gorm:"size:30;index;not null" json:"purpose"`
+	TokenHash string     `gorm:"size:255;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"default:NULL" json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName is Database TableName of this model
+func (e *VerificationToken) TableName() string {
+	return "verification_tokens"
+}
@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// Versioned counts the writes to a row for optimistic concurrency control: a write names the
+// version it read and fails if the row has moved on since.
+type Versioned struct {
+	Version uint `gorm:"not null;default:1"`
+}
+
+// BeforeCreate starts the count at 1.
+func (v *Versioned) BeforeCreate(tx *gorm.DB) error {
+	if v.Version == 0 {
+		v.Version = 1
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import "gorm.io/gorm"
 
 type Widget struct {
 	gorm.Model
+	Versioned
 	Type      string `gorm:"size:50"` // e.g., "sidebar", "footer"
 	Title     string `gorm:"size:255"`
 	Content   string `gorm:"type:text"`
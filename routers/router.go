@@ -2,6 +2,7 @@ package routers
 
 import (
 	"beres/controllers"
+	"beres/models"
 	"beres/routers/middleware"
 
 	"github.com/gin-gonic/gin"
@@ -25,30 +26,46 @@ func SetupRoute() *gin.Engine {
 	router.Use(middleware.CORSMiddleware())
 	router.POST("/register", controllers.Register)
 	router.POST("/login", controllers.Login)
+	router.POST("/login/two-factor", controllers.LoginTwoFactor)
+	router.POST("/token/refresh", controllers.RefreshSession)
+	router.POST("/password/forgot", controllers.ForgotPassword)
+	router.POST("/password/reset", controllers.ResetPassword)
+	router.POST("/email/verify", controllers.VerifyEmail)
+	router.GET("/search", middleware.OptionalTokenAuth(), controllers.SearchPosts)
 	sections := router.Group("/sections")
 	{
 		sections.GET("", controllers.GetSectionData)     // GET    /sections
 		sections.GET("/:id", controllers.GetSectionByID) // GET    /sections/:id
 	}
 
-	posts := router.Group("/posts")
+	// signed-in callers may also see unpublished posts, see controllers.visiblePosts
+	posts := router.Group("/posts", middleware.OptionalTokenAuth())
 	{
-		posts.GET("", controllers.GetPosts)        // GET    /posts      (list)
-		posts.GET("/:id", controllers.GetPostByID) // GET    /posts/:id  (retrieve)
+		posts.GET("", controllers.GetPosts)                 // GET    /posts      (list)
+		posts.GET("/:id", controllers.GetPostByID)          // GET    /posts/:id  (retrieve)
+		posts.GET("/slug/:slug", controllers.GetPostBySlug) // GET    /posts/slug/:slug
 	}
 
 	// Categories CRUD
 	categories := router.Group("/categories")
 	{
 		categories.GET("", controllers.GetCategories)
+		categories.GET("/tree", middleware.OptionalTokenAuth(), controllers.GetCategoryTree) // nested, with post counts
+		categories.GET("/:id/breadcrumbs", controllers.GetCategoryBreadcrumbs)               // :id is a slug or an ID
 		categories.GET("/:id", controllers.GetCategoryByID)
+		categories.GET("/slug/:slug", controllers.GetCategoryBySlug)
+		categories.GET("/:id/posts", middleware.OptionalTokenAuth(), controllers.GetCategoryPosts) // :id is a slug or an ID
 	}
 
 	// Tags CRUD
 	tags := router.Group("/tags")
 	{
 		tags.GET("", controllers.GetTags)
+		tags.GET("/autocomplete", controllers.TagAutocomplete) // ?q=go&limit=10
+		tags.GET("/cloud", controllers.GetTagCloud)            // ?limit=50&weights=5
 		tags.GET("/:id", controllers.GetTagByID)
+		tags.GET("/slug/:slug", controllers.GetTagBySlug)
+		tags.GET("/:id/posts", middleware.OptionalTokenAuth(), controllers.GetTagPosts) // :id is a slug or an ID
 	}
 
 	menus := router.Group("/menus")
@@ -84,60 +101,142 @@ func SetupRoute() *gin.Engine {
 	{
 		auth.POST("/logout", controllers.Logout)
 
-		settings := router.Group("/settings")
+		tokens := auth.Group("/tokens")
+		{
+			tokens.GET("", controllers.GetTokens)
+			tokens.POST("", controllers.CreateToken)
+			tokens.POST("/revoke-others", controllers.RevokeOtherTokens)
+			tokens.PUT("/:id", controllers.RenameToken)
+			tokens.DELETE("/:id", controllers.RevokeToken)
+		}
+		auth.POST("/email/verification-notification", controllers.ResendVerification)
+
+		twoFactor := auth.Group("/two-factor")
+		{
+			twoFactor.POST("/enable", controllers.EnableTwoFactor)
+			twoFactor.POST("/confirm", controllers.ConfirmTwoFactor)
+			twoFactor.POST("/recovery-codes", controllers.RegenerateRecoveryCodes)
+			twoFactor.DELETE("", controllers.DisableTwoFactor)
+		}
+
+		me := auth.Group("/me")
+		{
+			me.GET("", controllers.GetProfile)
+			me.PUT("", controllers.UpdateProfile)
+			me.PATCH("", controllers.UpdateProfile)
+			me.PUT("/password", controllers.ChangePassword)
+			me.PUT("/avatar", controllers.UpdateAvatar)
+		}
+
+		users := auth.Group("/users", middleware.RequireAbility(models.AbilityUsersManage))
+		{
+			users.GET("", controllers.GetUsers)
+			users.GET("/:id", controllers.GetUserByID)
+			users.POST("", controllers.CreateUser)
+			users.PUT("/:id", controllers.UpdateUser)
+			users.PATCH("/:id", controllers.UpdateUser)
+			users.DELETE("/:id", controllers.DeleteUser)
+			users.POST("/:id/deactivate", controllers.DeactivateUser)
+			users.POST("/:id/activate", controllers.ActivateUser)
+			users.POST("/:id/unlock", controllers.UnlockUser)
+		}
+
+		auth.GET("/audit-logs", middleware.RequireAbility(models.AbilityAuditRead), controllers.GetAuditLogs)
+	}
+
+	// content writes additionally require a verified email address
+	content := router.Group("/")
+	content.Use(middleware.TokenAuth(), middleware.RequireVerifiedEmail())
+	{
+		settings := content.Group("/settings", middleware.RequireAbility(models.AbilitySettingsWrite))
 		{
 			settings.POST("", controllers.CreateSetting)
 			settings.PUT("/:id", controllers.UpdateSetting)
+			settings.PATCH("/:id", controllers.UpdateSetting)
 			settings.DELETE("/:id", controllers.DeleteSetting)
 		}
 
-		widgets := router.Group("/widgets")
+		widgets := content.Group("/widgets", middleware.RequireAbility(models.AbilityWidgetsWrite))
 		{
 			widgets.POST("", controllers.CreateWidget)
 			widgets.PUT("/:id", controllers.UpdateWidget)
+			widgets.PATCH("/:id", controllers.UpdateWidget)
 			widgets.DELETE("/:id", controllers.DeleteWidget)
 		}
 
-		sections := auth.Group("/sections")
+		sections := content.Group("/sections", middleware.RequireAbility(models.AbilitySectionsWrite))
 		{
 			sections.POST("", controllers.CreateSection)       // POST   /sections
 			sections.PUT("/:id", controllers.UpdateSection)    // PUT    /sections/:id
+			sections.PATCH("/:id", controllers.UpdateSection)  // PATCH  /sections/:id
 			sections.DELETE("/:id", controllers.DeleteSection) // DELETE /sections/:id
 		}
-		posts := auth.Group("/posts")
+		// ownership (posts:edit_others / posts:delete_others) is checked in the handlers
+		posts := content.Group("/posts")
 		{
-			posts.POST("", controllers.CreatePost)       // POST   /posts      (create)
-			posts.PUT("/:id", controllers.UpdatePost)    // PUT    /posts/:id  (update)
-			posts.DELETE("/:id", controllers.DeletePost) // DELETE /posts/:id  (delete)
+			posts.POST("", middleware.RequireAbility(models.AbilityPostsCreate), controllers.CreatePost)       // POST   /posts      (create)
+			posts.PUT("/:id", middleware.RequireAbility(models.AbilityPostsEdit), controllers.UpdatePost)      // PUT    /posts/:id  (update)
+			posts.PATCH("/:id", middleware.RequireAbility(models.AbilityPostsEdit), controllers.UpdatePost)    // PATCH  /posts/:id  (merge patch)
+			posts.DELETE("/:id", middleware.RequireAbility(models.AbilityPostsDelete), controllers.DeletePost) // DELETE /posts/:id  (delete)
+
+			// editorial workflow; the ability of each step is checked in the handler
+			posts.GET("/review-queue", middleware.RequireAbility(models.AbilityPostsReview), controllers.GetReviewQueue)
+			posts.GET("/:id/transitions", controllers.GetPostTransitions)
+			posts.POST("/:id/transitions", controllers.TransitionPost) // {"action":"submit|withdraw|approve|reject|publish","note":""}
+
+			revisions := posts.Group("/:id/revisions", middleware.RequireAbility(models.AbilityPostsEdit))
+			{
+				revisions.GET("", controllers.GetPostRevisions)
+				revisions.GET("/compare", controllers.ComparePostRevisions) // ?from=&to= revision IDs
+				revisions.GET("/:revision_id", controllers.GetPostRevision)
+				revisions.POST("/:revision_id/restore", controllers.RestorePostRevision)
+			}
 		}
 
-		items := router.Group("/items")
+		items := content.Group("/items", middleware.RequireAbility(models.AbilityMenusWrite))
 		{
 			items.POST("", controllers.CreateMenuItem)
 			items.PUT("/:id", controllers.UpdateMenuItem)
+			items.PATCH("/:id", controllers.UpdateMenuItem)
 			items.DELETE("/:id", controllers.DeleteMenuItem)
 		}
 
-		menus := router.Group("/menus")
+		menus := content.Group("/menus", middleware.RequireAbility(models.AbilityMenusWrite))
 		{
 			menus.POST("", controllers.CreateMenu)
 			menus.PUT("/:id", controllers.UpdateMenu)
+			menus.PATCH("/:id", controllers.UpdateMenu)
 			menus.DELETE("/:id", controllers.DeleteMenu)
+			menus.PUT("/:id/items", controllers.ArrangeMenuItems) // {"items":[{"id":1,"parent_id":null,"order":0}, ...]}
 		}
 
-		tags := router.Group("/tags")
+		tags := content.Group("/tags", middleware.RequireAbility(models.AbilityTagsWrite))
 		{
 			tags.POST("", controllers.CreateTag)
 			tags.PUT("/:id", controllers.UpdateTag)
+			tags.PATCH("/:id", controllers.UpdateTag)
 			tags.DELETE("/:id", controllers.DeleteTag)
+			tags.POST("/:id/merge", controllers.MergeTags)                                                        // {"target_id": 5}
+			tags.POST("/:id/posts", middleware.RequireAbility(models.AbilityPostsEdit), controllers.BulkTagPosts) // {"action": "add|remove", "filter": {"category": "go"}}
 		}
 
 		// Categories CRUD
-		categories := router.Group("/categories")
+		categories := content.Group("/categories", middleware.RequireAbility(models.AbilityCategoriesWrite))
 		{
 			categories.POST("", controllers.CreateCategory)
 			categories.PUT("/:id", controllers.UpdateCategory)
+			categories.PATCH("/:id", controllers.UpdateCategory)
 			categories.DELETE("/:id", controllers.DeleteCategory)
+			categories.POST("/:id/move", controllers.MoveCategory)     // {"parent_id": 3} or null for the top level
+			categories.POST("/:id/merge", controllers.MergeCategories) // {"target_id": 5}
+		}
+
+		// deleted content of each type in models.Trashables; the type's ability is checked in the handlers
+		trash := content.Group("/trash")
+		{
+			trash.GET("/:type", controllers.GetTrash)
+			trash.POST("/:type/:id/restore", controllers.RestoreTrashed)
+			trash.DELETE("/:type/:id", controllers.PurgeTrashed)
 		}
 	}
 